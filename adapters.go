@@ -0,0 +1,101 @@
+// Enumerating the I2C adapters of the system from sysfs
+package piicodev
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrAdapterNotFound is matched by errors for an adapter name that does not match exactly one adapter
+var ErrAdapterNotFound = errors.New("I2C adapter not found")
+
+// sysfsRoot is the mount point of sysfs, replaced by tests
+var sysfsRoot = "/sys"
+
+// Adapter is an I2C adapter of the system
+type Adapter struct {
+	Number int    // the bus number as used by OpenBus
+	Name   string // the name of the adapter from the kernel driver, e.g. "bcm2835 (i2c@7e804000)"
+	Device string // the device node, e.g. /dev/i2c-1
+}
+
+// Adapters lists the I2C adapters in /sys/class/i2c-adapter in order of bus number
+func Adapters() (adapters []Adapter, err error) {
+	var entries []os.DirEntry
+	if entries, err = os.ReadDir(filepath.Join(sysfsRoot, "class", "i2c-adapter")); err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		var n int
+		if !strings.HasPrefix(e.Name(), "i2c-") {
+			continue
+		}
+
+		if n, err = strconv.Atoi(strings.TrimPrefix(e.Name(), "i2c-")); err != nil {
+			err = nil
+			continue
+		}
+
+		var name []byte
+		if name, err = os.ReadFile(filepath.Join(sysfsRoot, "class", "i2c-adapter", e.Name(), "name")); err != nil {
+			return
+		}
+
+		adapters = append(adapters, Adapter{
+			Number: n,
+			Name:   strings.TrimSpace(string(name)),
+			Device: fmt.Sprintf("/dev/i2c-%d", n),
+		})
+	}
+
+	sort.Slice(adapters, func(i, j int) bool { return adapters[i].Number < adapters[j].Number })
+	return
+}
+
+// FindAdapter returns the adapter with a name. If no adapter has exactly the name,
+// the only adapter with a name containing it is returned, so that "i2c@7e804000"
+// finds "bcm2835 (i2c@7e804000)".
+func FindAdapter(name string) (a Adapter, err error) {
+	var adapters []Adapter
+	if adapters, err = Adapters(); err != nil {
+		return
+	}
+
+	var matches []Adapter
+	for _, c := range adapters {
+		if c.Name == name {
+			return c, nil
+		}
+
+		if strings.Contains(c.Name, name) {
+			matches = append(matches, c)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		err = fmt.Errorf("%w: no adapter is named %q", ErrAdapterNotFound, name)
+	case 1:
+		a = matches[0]
+	default:
+		err = fmt.Errorf("%w: %d adapters have names containing %q", ErrAdapterNotFound, len(matches), name)
+	}
+
+	return
+}
+
+// OpenBusByName opens the bus of the adapter found with FindAdapter
+func OpenBusByName(name string) (b *Bus, err error) {
+	var a Adapter
+	if a, err = FindAdapter(name); err != nil {
+		return
+	}
+
+	return OpenBus(a.Number)
+}
@@ -0,0 +1,95 @@
+package piicodev
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+// fakeSysfs creates a sysfs tree with adapters of the names keyed by bus number
+func fakeSysfs(t *testing.T, adapters map[int]string) {
+	root := t.TempDir()
+	for n, name := range adapters {
+		dir := filepath.Join(root, "class", "i2c-adapter", "i2c-"+strconv.Itoa(n))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Error creating the fake sysfs: %v", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, "name"), []byte(name+"\n"), 0644); err != nil {
+			t.Fatalf("Error creating the fake sysfs: %v", err)
+		}
+	}
+
+	saved := sysfsRoot
+	sysfsRoot = root
+	t.Cleanup(func() { sysfsRoot = saved })
+}
+
+func TestAdapters(t *testing.T) {
+	fakeSysfs(t, map[int]string{
+		20: "",
+		1:  "bcm2835 (i2c@7e804000)",
+		2:  "bcm2835 (i2c@7e805000)",
+		10: "fef04500.i2c",
+	})
+
+	adapters, err := Adapters()
+	if err != nil {
+		t.Fatalf("Error listing the adapters: %v", err)
+	}
+
+	var numbers []int
+	for _, a := range adapters {
+		numbers = append(numbers, a.Number)
+	}
+
+	if !reflect.DeepEqual(numbers, []int{1, 2, 10, 20}) || adapters[0].Name != "bcm2835 (i2c@7e804000)" || adapters[2].Device != "/dev/i2c-10" {
+		t.Errorf("Adapters are %+v", adapters)
+	}
+
+	for name, want := range map[string]int{
+		"fef04500.i2c":  10,
+		"i2c@7e805000":  2,
+		"bcm2835 (i2c@": -1,
+		"i2c-3":         -1,
+	} {
+		a, err := FindAdapter(name)
+		if want < 0 {
+			if !errors.Is(err, ErrAdapterNotFound) {
+				t.Errorf("Finding %q returned %+v (%v)", name, a, err)
+			}
+		} else if err != nil || a.Number != want {
+			t.Errorf("Found %q as bus %d (%v) rather than %d", name, a.Number, err, want)
+		}
+	}
+}
+
+func TestKernelDriver(t *testing.T) {
+	fakeSysfs(t, map[int]string{1: "bcm2835 (i2c@7e804000)"})
+
+	devices := filepath.Join(sysfsRoot, "bus", "i2c", "devices")
+	for _, dir := range []string{"1-0048", "1-0049"} {
+		if err := os.MkdirAll(filepath.Join(devices, dir), 0755); err != nil {
+			t.Fatalf("Error creating the fake sysfs: %v", err)
+		}
+	}
+
+	if err := os.Symlink("../../../../bus/i2c/drivers/lm75", filepath.Join(devices, "1-0048", "driver")); err != nil {
+		t.Fatalf("Error creating the fake sysfs: %v", err)
+	}
+
+	for address, want := range map[uint8]string{0x48: "lm75", 0x49: "", 0x50: ""} {
+		if driver, err := KernelDriver(1, address); err != nil || driver != want {
+			t.Errorf("Driver of 0x%X is %q (%v) rather than %q", address, driver, err, want)
+		}
+	}
+
+	err := error(&KernelDriverError{Bus: 1, Address: 0x48, Driver: "lm75", Err: &I2CError{Op: "set address", Bus: 1, Address: 0x48, Reg: -1, Errno: syscall.EBUSY}})
+	if !errors.Is(err, ErrBusy) || err.Error() != "I2C address 0x48 on bus 1 is in use by the kernel driver lm75, unbind the driver or open the device with force" {
+		t.Errorf("Kernel driver error is %v", err)
+	}
+}
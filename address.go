@@ -0,0 +1,96 @@
+// Changing the I2C address of devices with an address register
+package piicodev
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidAddress is matched by errors for an address that cannot be assigned to a device
+var ErrInvalidAddress = errors.New("invalid I2C address")
+
+const (
+	// changeAddressPoll is the interval between checks that a device answers at its new address
+	changeAddressPoll = 5 * time.Millisecond
+
+	// changeAddressAttempts limits the checks that a device answers at its new address
+	changeAddressAttempts = 20
+)
+
+// readdresser is implemented by connections that can be moved to another address on the same bus
+type readdresser interface {
+	// withAddress returns a connection to another address on the same bus, which
+	// takes over closing the bus from the connection
+	withAddress(address uint8) Conn
+}
+
+// readdress returns a handle to another address on the same bus with the same
+// retry policy, tracer and clock. The handle should not be used afterwards.
+func (i2c *I2C) readdress(address uint8) (moved *I2C, err error) {
+	r, ok := i2c.Conn.(readdresser)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	return i2c.withConn(r.withAddress(address)), nil
+}
+
+// changeAddress validates a new address and writes it to a device, then returns
+// the handle moved to the new address once the device answers there. The moved
+// handle is returned even if the device does not answer, as the address has been
+// written, and the unchanged handle is returned if the address was not written.
+func changeAddress(i2c *I2C, device string, address uint8, write func() error, answers func(i2c *I2C) bool) (moved *I2C, err error) {
+	moved = i2c
+
+	if address < ScanFirstAddress || address > ScanLastAddress {
+		err = fmt.Errorf("%w 0x%X for the %s, must be from 0x%X to 0x%X", ErrInvalidAddress, address, device, ScanFirstAddress, ScanLastAddress)
+		return
+	}
+
+	if _, ok := i2c.Conn.(readdresser); !ok {
+		err = ErrNotSupported
+		return
+	}
+
+	if err = write(); err != nil {
+		return
+	}
+
+	if moved, err = i2c.readdress(address); err != nil {
+		return
+	}
+
+	for attempt := 1; !answers(moved); attempt++ {
+		if attempt >= changeAddressAttempts {
+			err = &TimeoutError{Device: device, Op: "address change"}
+			return
+		}
+
+		moved.sleep(context.Background(), changeAddressPoll)
+	}
+
+	return
+}
+
+func (d *devConn) withAddress(address uint8) Conn {
+	d.bufMu.Lock()
+	defer d.bufMu.Unlock()
+
+	moved := &devConn{bus: d.bus, slaveAddr: slaveAddr{address: uint16(address), force: d.force}, ownsBus: d.ownsBus, pec: d.pec}
+	d.ownsBus = false
+	return moved
+}
+
+func (c *remoteConn) withAddress(address uint8) Conn {
+	return &remoteConn{bus: c.bus, slaveAddr: slaveAddr{address: uint16(address)}}
+}
+
+func (c *muxConn) withAddress(address uint8) Conn {
+	return &muxConn{ch: c.ch, conn: c.ch.mux.parent.Open(address).Conn}
+}
+
+func (c *replayConn) withAddress(address uint8) Conn {
+	return &replayConn{replay: c.replay, address: uint16(address)}
+}
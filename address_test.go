@@ -0,0 +1,72 @@
+package piicodev
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetAddress(t *testing.T) {
+	f := NewFakeConn()
+	f.SetReg(_SWITCH_REG_WHOAMI, 0x01, 0x99)
+
+	s, err := NewSwitchWithConn(f)
+	if err != nil {
+		t.Fatalf("Error creating the switch: %v", err)
+	}
+
+	if err = s.SetAddress(0x78); !errors.Is(err, ErrInvalidAddress) || len(f.Writes()) != 0 {
+		t.Errorf("Invalid address returned %v after %d writes", err, len(f.Writes()))
+	}
+
+	if err = s.SetAddress(0x30); err != nil {
+		t.Fatalf("Error changing the switch address: %v", err)
+	}
+
+	if writes := f.Writes(); len(writes) != 1 || !bytes.Equal(writes[0], []byte{_SWITCH_REG_I2C_ADDRESS | 0x80, 0x30}) {
+		t.Errorf("Address change wrote %X", writes)
+	}
+
+	if a := s.i2c.Address(); a != 0x30 {
+		t.Errorf("Switch handle is at address 0x%X rather than 0x30", a)
+	}
+
+	wrapped, _ := NewSwitchWithConn(struct{ Conn }{f})
+	if err = wrapped.SetAddress(0x31); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Address change on a connection that cannot be moved returned %v", err)
+	}
+}
+
+func TestSetAddressNotAnswering(t *testing.T) {
+	f := NewFakeConn()
+	b, _ := NewBuzzerWithConn(f)
+
+	clock := NewFakeClock(time.Now())
+	clock.SetAutoAdvance(true)
+	b.i2c.SetClock(clock)
+
+	var timeout *TimeoutError
+	if err := b.SetAddress(0x40); !errors.As(err, &timeout) || b.i2c.Address() != 0x40 {
+		t.Errorf("Address change of a device that does not answer returned %v at address 0x%X", err, b.i2c.Address())
+	}
+}
+
+func TestReaddressBus(t *testing.T) {
+	b := &Bus{bus: 3, locks: make(map[uint16]*sync.Mutex), slave: -1}
+	d := &devConn{bus: b, slaveAddr: slaveAddr{address: 0x42, force: true}, ownsBus: true}
+
+	i2c := NewI2C(d)
+	i2c.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3})
+
+	moved, err := i2c.readdress(0x43)
+	if err != nil {
+		t.Fatalf("Error moving the handle: %v", err)
+	}
+
+	m := moved.Conn.(*devConn)
+	if m.bus != b || m.address != 0x43 || !m.force || !m.ownsBus || d.ownsBus || moved.RetryPolicy() == nil {
+		t.Errorf("Moved handle is %+v with retry policy %v", m, moved.RetryPolicy())
+	}
+}
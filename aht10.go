@@ -26,7 +26,7 @@ package piicodev
  */
 
 import (
-	"fmt"
+	"context"
 	"time"
 )
 
@@ -58,22 +58,39 @@ const (
 )
 
 func NewAHT10(addr uint8, bus int) (s *AHT10, err error) {
-	s = new(AHT10)
-
-	if s.i2c, err = OpenI2C(addr, bus); err != nil {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
 		return
 	}
 
+	return NewAHT10WithConn(i2c)
+}
+
+// NewAHT10WithConn creates a new AHT10 instance on an already open connection
+func NewAHT10WithConn(conn Conn) (s *AHT10, err error) {
+	return NewAHT10WithConnContext(context.Background(), conn)
+}
+
+// NewAHT10WithConnContext creates a new AHT10 instance on an already open
+// connection, stopping the waits for the initialisation if the context is done
+func NewAHT10WithConnContext(ctx context.Context, conn Conn) (s *AHT10, err error) {
+	i2c := NewI2C(conn)
+	s = &AHT10{i2c: i2c.withContext(ctx)}
+	defer func() { s.i2c = i2c }()
+
 	if err = s.SoftReset(); err != nil {
 		return
 	}
 
-	time.Sleep(100 * time.Millisecond)
+	if err = s.i2c.sleep(ctx, 100*time.Millisecond); err != nil {
+		return
+	}
+
 	if err = s.SetInitRegister(_AHTXX_INIT_CTRL_CAL_ON | _AHT1X_STATUS_CTRL_NORMAL_MODE); err != nil {
 		return
 	}
 
-	time.Sleep(100 * time.Millisecond)
+	err = s.i2c.sleep(ctx, 100*time.Millisecond)
 	return
 }
 
@@ -94,6 +111,16 @@ func calculateCRC(data []uint8) (crc uint8) {
 }
 
 func (s *AHT10) ReadSensor() (temperature float64, humidity float64, err error) {
+	return s.ReadSensorContext(context.Background())
+}
+
+// ReadSensorContext reads the temperature and humidity, stopping the wait for
+// the measurement if the context is done
+func (s *AHT10) ReadSensorContext(ctx context.Context) (temperature float64, humidity float64, err error) {
+	s = &AHT10{i2c: s.i2c.withContext(ctx)}
+	s.i2c.Lock()
+	defer s.i2c.Unlock()
+
 	// Start measurement
 	if err = s.i2c.WriteReg(_AHTXX_REG_START_MEASUREMENT, []byte{0x33, 0x00}); err != nil {
 		return
@@ -103,7 +130,9 @@ func (s *AHT10) ReadSensor() (temperature float64, humidity float64, err error)
 	var status uint8
 
 	for i := 0; i < 20; i++ {
-		time.Sleep(10 * time.Millisecond)
+		if err = s.i2c.sleep(ctx, 10*time.Millisecond); err != nil {
+			return
+		}
 
 		if status, err = s.GetStatus(); err != nil {
 			return
@@ -115,7 +144,7 @@ func (s *AHT10) ReadSensor() (temperature float64, humidity float64, err error)
 	}
 
 	if (status & _AHTXX_STATUS_CTRL_BUSY) == _AHTXX_STATUS_CTRL_BUSY {
-		err = fmt.Errorf("timeout waiting for AHT10 sensor measurement to complete")
+		err = &TimeoutError{Device: "AHT10", Op: "sensor measurement"}
 		return
 	}
 
@@ -127,7 +156,7 @@ func (s *AHT10) ReadSensor() (temperature float64, humidity float64, err error)
 
 	crc := calculateCRC(data)
 	if crc != 0 {
-		err = fmt.Errorf("the calculated CRC of AHT10 sensor data is not zero: 0x%x", crc)
+		err = &ChecksumError{Device: "AHT10", CRC: uint32(crc)}
 		return
 	}
 
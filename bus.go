@@ -0,0 +1,223 @@
+// Shared access to a Linux /dev/i2c-{bus} adapter for multiple devices
+package piicodev
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// Bus is a single open handle to an I2C adapter shared by all devices on it.
+// Devices are addressed in each I2C_RDWR transaction rather than with I2C_SLAVE,
+// so any number of devices can use the one file descriptor. Transactions are
+// serialised by the bus and each address has a lock for multi-step sequences.
+type Bus struct {
+	retries uint64 // first for 64-bit alignment of atomic access on 32-bit platforms
+	dev     *os.File
+	bus     int
+	mu      sync.Mutex
+	locks   map[uint16]*sync.Mutex
+	cfgMu   sync.Mutex
+	retry   *RetryPolicy
+	tracer  Tracer
+	slave   int  // the address set with I2C_SLAVE or -1
+	force   bool // whether the address was set with I2C_SLAVE_FORCE
+	tenBit  bool // whether 10-bit addresses are set with I2C_TENBIT
+	pec     bool // whether packet error checking is set with I2C_PEC
+	funcs   Functionality
+}
+
+// OpenBus opens the I2C adapter /dev/i2c-{bus} and queries what it supports
+func OpenBus(bus int) (b *Bus, err error) {
+	b = &Bus{bus: bus, locks: make(map[uint16]*sync.Mutex), slave: -1}
+
+	if b.dev, err = os.OpenFile(fmt.Sprintf("/dev/i2c-%d", bus), os.O_RDWR, 0600); err != nil {
+		return
+	}
+
+	if errno := b.queryFunctionality(); errno != 0 {
+		b.dev.Close()
+		err = &BusError{Op: "query the functionality of", Bus: bus, Errno: errno}
+		return
+	}
+
+	return
+}
+
+// Number returns the bus number of the adapter
+func (b *Bus) Number() int {
+	return b.bus
+}
+
+// Open returns a handle to the device at an address on the bus, which can be
+// passed to any of the NewXxxWithConn driver constructors. Closing the handle
+// does not close the bus.
+func (b *Bus) Open(address uint8) *I2C {
+	return NewI2C(&devConn{bus: b, slaveAddr: slaveAddr{address: uint16(address)}})
+}
+
+// Open10 returns a handle to the device at a 10-bit address (0x000 to 0x3FF) on
+// the bus. The adapter must support Func10BitAddr.
+func (b *Bus) Open10(address uint16) *I2C {
+	return NewI2C(&devConn{bus: b, slaveAddr: slaveAddr{address: address, tenBit: true}})
+}
+
+// OpenForce returns a handle to the device at an address like Open, but its
+// SMBus transactions use I2C_SLAVE_FORCE so that they are made even if a kernel
+// driver is bound to the address. Only use it if the kernel driver will not be
+// disturbed, as the device is then accessed by both.
+func (b *Bus) OpenForce(address uint8) *I2C {
+	return NewI2C(&devConn{bus: b, slaveAddr: slaveAddr{address: uint16(address), force: true}})
+}
+
+// slaveAddr is the address of a device on a bus
+type slaveAddr struct {
+	address uint16
+	tenBit  bool // the address is a 10-bit address
+	force   bool // use the address even if a kernel driver is bound to it
+}
+
+// msgFlags returns the flags of the messages to the address
+func (a slaveAddr) msgFlags() uint16 {
+	if a.tenBit {
+		return I2C_M_TEN
+	}
+
+	return 0
+}
+
+// key distinguishes 10-bit addresses from 7-bit addresses
+func (a slaveAddr) key() uint16 {
+	if a.tenBit {
+		return 0x8000 | a.address
+	}
+
+	return a.address
+}
+
+// addressLock returns the lock for multi-step sequences with the device at an address
+func (b *Bus) addressLock(a slaveAddr) *sync.Mutex {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	l, ok := b.locks[a.key()]
+	if !ok {
+		l = new(sync.Mutex)
+		b.locks[a.key()] = l
+	}
+
+	return l
+}
+
+// rdwr submits messages to the adapter in a single I2C_RDWR ioctl call, failing
+// with EOPNOTSUPP if the adapter does not support plain I2C messages
+func (b *Bus) rdwr(messages []i2c_msg) (errno syscall.Errno) {
+	if !b.funcs.Has(FuncI2C) || (messages[0].flags&I2C_M_TEN != 0 && !b.funcs.Has(Func10BitAddr)) {
+		return syscall.EOPNOTSUPP
+	}
+
+	request := i2c_rdwr_ioctl_data{
+		msgs: &messages[0],
+		nmsg: uint32(len(messages)),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if rdwrHook != nil {
+		errno = rdwrHook(request)
+	} else {
+		errno = ioctlPtr(b.dev, I2C_RDWR, unsafe.Pointer(&request))
+	}
+
+	runtime.KeepAlive(messages)
+	return
+}
+
+// setSlave sets the address of the SMBus transactions with I2C_SLAVE, or with
+// I2C_SLAVE_FORCE to use an address in use by a kernel driver, unless it is
+// already set with the same request.
+// Must be called with the bus lock held.
+func (b *Bus) setSlave(a slaveAddr) (errno syscall.Errno) {
+	if b.slave == int(a.address) && b.tenBit == a.tenBit && b.force == a.force {
+		return
+	}
+
+	if b.tenBit != a.tenBit {
+		var on uintptr
+		if a.tenBit {
+			on = 1
+		}
+
+		b.slave = -1
+		if errno = ioctl(b.dev, I2C_TENBIT, on); errno != 0 {
+			return
+		}
+
+		b.tenBit = a.tenBit
+	}
+
+	req := I2C_SLAVE
+	if a.force {
+		req = I2C_SLAVE_FORCE
+	}
+
+	if errno = ioctl(b.dev, req, uintptr(a.address)); errno == 0 {
+		b.slave, b.force = int(a.address), a.force
+	}
+
+	return
+}
+
+// smbus makes an SMBus transaction with the device at an address in a single
+// I2C_SMBUS ioctl call, first setting the address and packet error checking. Fails
+// with EOPNOTSUPP if the adapter does not support the protocol or PEC.
+func (b *Bus) smbus(a slaveAddr, pec bool, readWrite uint8, command byte, size uint32, data *i2c_smbus_data) (errno syscall.Errno) {
+	if !b.funcs.Has(smbusFunctionality(readWrite == I2C_SMBUS_READ, SMBusProtocol(size))) || (pec && !b.funcs.Has(FuncSMBusPEC)) || (a.tenBit && !b.funcs.Has(Func10BitAddr)) {
+		return syscall.EOPNOTSUPP
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errno = b.setSlave(a); errno != 0 {
+		return
+	}
+
+	if b.pec != pec {
+		var on uintptr
+		if pec {
+			on = 1
+		}
+
+		if errno = ioctl(b.dev, I2C_PEC, on); errno != 0 {
+			return
+		}
+
+		b.pec = pec
+	}
+
+	request := i2c_smbus_ioctl_data{
+		read_write: readWrite,
+		command:    command,
+		size:       size,
+		data:       data,
+	}
+
+	if smbusHook != nil {
+		errno = smbusHook(request)
+	} else {
+		errno = ioctlPtr(b.dev, I2C_SMBUS, unsafe.Pointer(&request))
+	}
+
+	runtime.KeepAlive(data)
+	return
+}
+
+// Close closes the handle to the adapter
+func (b *Bus) Close() {
+	b.dev.Close()
+}
@@ -13,6 +13,8 @@ const (
 	BuzzerVolumeReg               = 0x06
 	BuzzerPowerLEDReg             = 0x07
 	BuzzerDeviceIDReg             = 0x11
+
+	BuzzerDeviceID = 0x51
 )
 
 type Buzzer struct {
@@ -21,11 +23,17 @@ type Buzzer struct {
 
 // NewBuzzer creates a new Buzzer instances
 func NewBuzzer(addr uint8, bus int) (b *Buzzer, err error) {
-	b = &Buzzer{}
-	if b.i2c, err = OpenI2C(addr, bus); err != nil {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
 		return
 	}
 
+	return NewBuzzerWithConn(i2c)
+}
+
+// NewBuzzerWithConn creates a new Buzzer instance on an already open connection
+func NewBuzzerWithConn(conn Conn) (b *Buzzer, err error) {
+	b = &Buzzer{i2c: NewI2C(conn)}
 	return
 }
 
@@ -80,6 +88,19 @@ func (b *Buzzer) NoTone() (err error) {
 	return
 }
 
+// SetAddress changes the I2C address of the Buzzer to an address from 0x08 to 0x77,
+// moves the handle to the new address and checks that the Buzzer answers there
+func (b *Buzzer) SetAddress(address uint8) (err error) {
+	b.i2c, err = changeAddress(b.i2c, "Buzzer", address,
+		func() error { return b.i2c.WriteRegU8(BuzzerI2CAddressReg, address) },
+		func(i2c *I2C) bool {
+			id, err := i2c.ReadRegU8(BuzzerDeviceIDReg)
+			return err == nil && id == BuzzerDeviceID
+		})
+
+	return
+}
+
 // Close cleans up the connection for the Buzzer instances
 func (b *Buzzer) Close() {
 	b.i2c.Close()
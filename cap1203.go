@@ -2,8 +2,6 @@
 // Spec sheet: https://ww1.microchip.com/downloads/en/DeviceDoc/00001572B.pdf
 package piicodev
 
-import "fmt"
-
 const CAP1203Address = 0x28
 
 const (
@@ -32,18 +30,25 @@ type CAP1203 struct {
 
 // NewCAP1203 creates a new CAP1203 touch sensor instance
 func NewCAP1203(addr uint8, bus int) (c *CAP1203, err error) {
-	c = &CAP1203{}
-	if c.i2c, err = OpenI2C(addr, bus); err != nil {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
 		return
 	}
 
+	return NewCAP1203WithConn(i2c)
+}
+
+// NewCAP1203WithConn creates a new CAP1203 instance on an already open connection
+func NewCAP1203WithConn(conn Conn) (c *CAP1203, err error) {
+	c = &CAP1203{i2c: NewI2C(conn)}
+
 	var prodID byte
 	if prodID, err = c.i2c.ReadRegU8(CAP1203ProdIDReg); err != nil {
 		return
 	}
 
 	if prodID != CAP1203ProdIDValue {
-		err = fmt.Errorf("CAP1203 product ID of 0x%x is not 0x%x", prodID, CAP1203ProdIDValue)
+		err = &DeviceIDError{Device: "CAP1203", ID: uint16(prodID), Expected: []uint16{CAP1203ProdIDValue}}
 		return
 	}
 
@@ -0,0 +1,156 @@
+// Clocks used for the delays of the drivers, including a fake for testing
+package piicodev
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of time for the delays and polling loops of the drivers
+// and the backoff between retries. The default is the system clock.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// After returns a channel which receives the current time once d has elapsed
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the Clock of the system
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SetClock sets the clock used by the driver of the device for its delays. Set it
+// on the connection passed to a NewXxxWithConn constructor to also apply it to the
+// delays during initialisation. Nil uses SystemClock.
+func (i2c *I2C) SetClock(c Clock) {
+	i2c = i2c.device()
+	i2c.cfgMu.Lock()
+	defer i2c.cfgMu.Unlock()
+
+	i2c.clock = c
+}
+
+// Clock returns the clock used for the delays of the device
+func (i2c *I2C) Clock() (c Clock) {
+	i2c = i2c.device()
+	i2c.cfgMu.Lock()
+	defer i2c.cfgMu.Unlock()
+
+	if c = i2c.clock; c == nil {
+		c = SystemClock
+	}
+
+	return
+}
+
+// FakeClock is a Clock for tests that only moves when it is advanced, so that
+// drivers can be tested without waiting for their delays. With auto advance
+// every wait completes immediately by moving the clock forward by its duration.
+type FakeClock struct {
+	mu          sync.Mutex
+	cond        *sync.Cond
+	now         time.Time
+	autoAdvance bool
+	waiters     []fakeWaiter
+}
+
+// fakeWaiter is a channel waiting for the fake clock to reach a time
+type fakeWaiter struct {
+	until time.Time
+	c     chan time.Time
+}
+
+// NewFakeClock creates a fake clock starting at a time
+func NewFakeClock(now time.Time) (c *FakeClock) {
+	c = &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return
+}
+
+// Now returns the time of the fake clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// After returns a channel which receives the time once the clock has been advanced by d
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := fakeWaiter{until: c.now.Add(d), c: make(chan time.Time, 1)}
+
+	if c.autoAdvance && d > 0 {
+		c.now = w.until
+	}
+
+	if !w.until.After(c.now) {
+		w.c <- c.now
+		return w.c
+	}
+
+	c.waiters = append(c.waiters, w)
+	c.cond.Broadcast()
+	return w.c
+}
+
+// Advance moves the clock forward, completing the waits that are due
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	sort.SliceStable(c.waiters, func(i, j int) bool { return c.waiters[i].until.Before(c.waiters[j].until) })
+
+	var pending []fakeWaiter
+	for _, w := range c.waiters {
+		if w.until.After(c.now) {
+			pending = append(pending, w)
+		} else {
+			w.c <- c.now
+		}
+	}
+
+	c.waiters = pending
+	c.cond.Broadcast()
+}
+
+// SetAutoAdvance sets whether every wait completes immediately by advancing the clock
+func (c *FakeClock) SetAutoAdvance(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.autoAdvance = on
+}
+
+// Waiters returns the number of waits that have not completed
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.waiters)
+}
+
+// BlockUntil waits until there are at least n waits that have not completed
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
@@ -0,0 +1,79 @@
+package piicodev
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFakeClockAutoAdvance(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	clock.SetAutoAdvance(true)
+
+	f := NewFakeConn()
+	f.SetReg16(_VL53L1X_MODEL_ID_REG, 0xEA, 0xCC)
+
+	i2c := NewI2C(f)
+	i2c.SetClock(clock)
+
+	if _, err := NewVL53L1XWithConn(i2c); err != nil {
+		t.Fatalf("Error while creating the VL53L1X: %v", err)
+	}
+
+	if d := clock.Now().Sub(start); d != 500*time.Millisecond {
+		t.Errorf("VL53L1X initialisation waited %v rather than 500ms", d)
+	}
+
+	i2c.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, Backoff: time.Second})
+	nak := &I2CError{Op: "read", Bus: 1, Address: 0x29, Reg: -1, Errno: syscall.EREMOTEIO}
+	f.QueueError(nak)
+	f.QueueError(nak)
+
+	if _, err := i2c.ReadReg16U16BE(_VL53L1X_MODEL_ID_REG); err != nil {
+		t.Errorf("Read after two NAKs returned %v", err)
+	}
+
+	if d := clock.Now().Sub(start); d != 3500*time.Millisecond {
+		t.Errorf("Retries backed off for %v rather than 3s", d-500*time.Millisecond)
+	}
+}
+
+func TestFakeClockAdvance(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+
+	f := NewFakeConn()
+	f.SetReg(_ADC_READ, 0x6A, 0x00, 0x00)
+
+	i2c := NewI2C(f)
+	i2c.SetClock(clock)
+
+	p := &MS5637{i2c: i2c, coeffs: make([]uint16, 7)}
+	p.SetResolution(_RESOLUTION_OSR_8192)
+
+	done := make(chan error)
+	go func() {
+		_, _, err := p.Read()
+		done <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(1)
+
+		clock.Advance(16 * time.Millisecond)
+		if n := clock.Waiters(); n != 1 {
+			t.Fatalf("Conversion completed before its conversion time")
+		}
+
+		clock.Advance(time.Millisecond)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Error reading the MS5637: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("MS5637 reading did not complete after advancing the clock")
+	}
+}
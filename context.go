@@ -0,0 +1,22 @@
+// Cancellable waits for the blocking operations of the drivers
+package piicodev
+
+import (
+	"context"
+	"time"
+)
+
+// sleep waits for a duration on the clock of the device or until the context is
+// done, returning the error of the context if it is
+func (i2c *I2C) sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case <-i2c.Clock().After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
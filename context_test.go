@@ -0,0 +1,70 @@
+package piicodev
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestContextCancelsWaits(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := NewVL53L1XWithConnContext(ctx, NewFakeConn()); !errors.Is(err, context.Canceled) {
+		t.Errorf("VL53L1X initialisation with a cancelled context returned %v", err)
+	}
+
+	f := NewFakeConn()
+	f.SetReg(_AHTXX_REG_STATUS, _AHTXX_STATUS_CTRL_BUSY)
+	s := &AHT10{i2c: NewI2C(f)}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 25*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, _, err := s.ReadSensorContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("AHT10 measurement past the deadline returned %v", err)
+	}
+
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Errorf("AHT10 measurement took %v after the deadline", d)
+	}
+
+	p := &MS5637{i2c: NewI2C(NewFakeConn())}
+	p.SetResolution(_RESOLUTION_OSR_8192)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := p.ReadContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("MS5637 reading with a cancelled context returned %v", err)
+	}
+}
+
+func TestContextCancelsRetryBackoff(t *testing.T) {
+	f := NewFakeConn()
+	p := &MS5637{i2c: NewI2C(f)}
+	p.SetResolution(_RESOLUTION_OSR_256)
+	p.i2c.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, Backoff: time.Hour, MaxBackoff: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 25*time.Millisecond)
+	defer cancel()
+
+	f.QueueError(nil)
+	f.QueueError(&I2CError{Op: "read", Bus: -1, Reg: _ADC_READ, Errno: syscall.EREMOTEIO})
+
+	start := time.Now()
+	if _, _, err := p.ReadContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("MS5637 reading retried past the deadline returned %v", err)
+	}
+
+	if d := time.Since(start); d > 150*time.Millisecond {
+		t.Errorf("MS5637 reading took %v after the deadline", d)
+	}
+
+	if n := p.i2c.Retries(); n != 0 {
+		t.Errorf("Counted %d retries of a cancelled backoff", n)
+	}
+}
@@ -0,0 +1,286 @@
+// Common interfaces of the device drivers
+package piicodev
+
+// Device is implemented by every driver
+type Device interface {
+	// Name returns the device type, which is the name of its driver in the registry
+	Name() string
+
+	// Address returns the I2C address of the device
+	Address() uint16
+
+	// Close closes the handle to the device
+	Close()
+}
+
+// Thermometer is a device that measures temperature
+type Thermometer interface {
+	ReadTemperature() (celsius float64, err error)
+}
+
+// Hygrometer is a device that measures relative humidity
+type Hygrometer interface {
+	ReadHumidity() (percent float64, err error)
+}
+
+// Barometer is a device that measures air pressure
+type Barometer interface {
+	ReadPressure() (hPa float64, err error)
+}
+
+// LightMeter is a device that measures ambient light
+type LightMeter interface {
+	ReadIlluminance() (lux float64, err error)
+}
+
+// RangeFinder is a device that measures the distance to an object
+type RangeFinder interface {
+	ReadDistance() (mm float64, err error)
+}
+
+// Accelerometer is a device that measures acceleration on three axes
+type Accelerometer interface {
+	ReadAcceleration() (x, y, z float64, err error) // in m/s²
+}
+
+// Gyroscope is a device that measures angular velocity on three axes
+type Gyroscope interface {
+	ReadAngularVelocity() (x, y, z float64, err error) // in degrees per second
+}
+
+var (
+	_ Device = (*AHT10)(nil)
+	_ Device = (*Buzzer)(nil)
+	_ Device = (*CAP1203)(nil)
+	_ Device = (*ENS160)(nil)
+	_ Device = (*LM75A)(nil)
+	_ Device = (*MPU6050)(nil)
+	_ Device = (*MS5637)(nil)
+	_ Device = (*Potentiometer)(nil)
+	_ Device = (*QwiicPIR)(nil)
+	_ Device = (*RGBLED)(nil)
+	_ Device = (*Switch)(nil)
+	_ Device = (*TCA9548A)(nil)
+	_ Device = (*TMP117)(nil)
+	_ Device = (*VEML6030)(nil)
+	_ Device = (*VEML6040)(nil)
+	_ Device = (*VL53L1X)(nil)
+
+	_ Thermometer = (*AHT10)(nil)
+	_ Thermometer = (*LM75A)(nil)
+	_ Thermometer = (*MPU6050)(nil)
+	_ Thermometer = (*MS5637)(nil)
+	_ Thermometer = (*TMP117)(nil)
+
+	_ Hygrometer    = (*AHT10)(nil)
+	_ Barometer     = (*MS5637)(nil)
+	_ LightMeter    = (*VEML6030)(nil)
+	_ LightMeter    = (*VEML6040)(nil)
+	_ RangeFinder   = (*VL53L1X)(nil)
+	_ Accelerometer = (*MPU6050)(nil)
+	_ Gyroscope     = (*MPU6050)(nil)
+)
+
+func (s *AHT10) Name() string {
+	return "AHT10"
+}
+
+func (s *AHT10) Address() uint16 {
+	return s.i2c.Address()
+}
+
+func (b *Buzzer) Name() string {
+	return "Buzzer"
+}
+
+func (b *Buzzer) Address() uint16 {
+	return b.i2c.Address()
+}
+
+func (c *CAP1203) Name() string {
+	return "CAP1203"
+}
+
+func (c *CAP1203) Address() uint16 {
+	return c.i2c.Address()
+}
+
+func (s *ENS160) Name() string {
+	return "ENS160"
+}
+
+func (s *ENS160) Address() uint16 {
+	return s.i2c.Address()
+}
+
+func (s *LM75A) Name() string {
+	return "LM75A"
+}
+
+func (s *LM75A) Address() uint16 {
+	return s.i2c.Address()
+}
+
+func (t *MPU6050) Name() string {
+	return "MPU6050"
+}
+
+func (t *MPU6050) Address() uint16 {
+	return t.i2c.Address()
+}
+
+func (p *MS5637) Name() string {
+	return "MS5637"
+}
+
+func (p *MS5637) Address() uint16 {
+	return p.i2c.Address()
+}
+
+func (s *Potentiometer) Name() string {
+	return "Potentiometer"
+}
+
+func (s *Potentiometer) Address() uint16 {
+	return s.i2c.Address()
+}
+
+func (p *QwiicPIR) Name() string {
+	return "QwiicPIR"
+}
+
+func (p *QwiicPIR) Address() uint16 {
+	return p.i2c.Address()
+}
+
+func (l *RGBLED) Name() string {
+	return "RGBLED"
+}
+
+func (l *RGBLED) Address() uint16 {
+	return l.i2c.Address()
+}
+
+func (s *Switch) Name() string {
+	return "Switch"
+}
+
+func (s *Switch) Address() uint16 {
+	return s.i2c.Address()
+}
+
+func (m *TCA9548A) Name() string {
+	return "TCA9548A"
+}
+
+func (m *TCA9548A) Address() uint16 {
+	return m.i2c.Address()
+}
+
+func (t *TMP117) Name() string {
+	return "TMP117"
+}
+
+func (t *TMP117) Address() uint16 {
+	return t.i2c.Address()
+}
+
+func (l *VEML6030) Name() string {
+	return "VEML6030"
+}
+
+func (l *VEML6030) Address() uint16 {
+	return l.i2c.Address()
+}
+
+func (c *VEML6040) Name() string {
+	return "VEML6040"
+}
+
+func (c *VEML6040) Address() uint16 {
+	return c.i2c.Address()
+}
+
+func (d *VL53L1X) Name() string {
+	return "VL53L1X"
+}
+
+func (d *VL53L1X) Address() uint16 {
+	return d.i2c.Address()
+}
+
+// ReadTemperature reads the temperature in degrees Celsius. Each call makes a
+// full measurement, so reading the temperature and then the humidity takes two
+// measurements at different times; use ReadSensor to read both from one.
+func (s *AHT10) ReadTemperature() (celsius float64, err error) {
+	celsius, _, err = s.ReadSensor()
+	return
+}
+
+// ReadHumidity reads the relative humidity in percent, making a full measurement
+// like ReadTemperature
+func (s *AHT10) ReadHumidity() (percent float64, err error) {
+	_, percent, err = s.ReadSensor()
+	return
+}
+
+// ReadTemperature reads the temperature in degrees Celsius. Each call makes both
+// conversions, so reading the temperature and then the pressure takes twice the
+// conversion time and the readings are from different times; use Read to read
+// both from one measurement.
+func (p *MS5637) ReadTemperature() (celsius float64, err error) {
+	_, celsius, err = p.Read()
+	return
+}
+
+// ReadPressure reads the air pressure in hectopascals, making both conversions
+// like ReadTemperature
+func (p *MS5637) ReadPressure() (hPa float64, err error) {
+	hPa, _, err = p.Read()
+	return
+}
+
+// ReadTemperature reads the temperature in degrees Celsius
+func (t *TMP117) ReadTemperature() (celsius float64, err error) {
+	return t.ReadTempC()
+}
+
+// ReadIlluminance reads the ambient light in lux
+func (l *VEML6030) ReadIlluminance() (lux float64, err error) {
+	return l.Read()
+}
+
+// ReadIlluminance reads the ambient light in lux from the green channel, with the
+// sensitivity of the integration time read from the configuration
+func (c *VEML6040) ReadIlluminance() (lux float64, err error) {
+	var config, green uint16
+	if config, err = c.i2c.ReadRegU16LE(VEML6040ConfigReg); err != nil {
+		return
+	}
+
+	if green, err = c.i2c.ReadRegU16LE(VEML6040GreenReg); err != nil {
+		return
+	}
+
+	// The sensitivity halves as the integration time doubles
+	it := min((config&_VEML6040_IT_MASK)>>_VEML6040_IT_SHIFT, _VEML6040_IT_MAX)
+	lux = float64(green) * _VEML6040_GREEN_SENSITIVITY / float64(uint(1)<<it)
+	return
+}
+
+// ReadDistance reads the distance to an object in millimetres
+func (d *VL53L1X) ReadDistance() (mm float64, err error) {
+	var rng uint16
+	rng, err = d.Read()
+	return float64(rng), err
+}
+
+// ReadAcceleration reads the acceleration in m/s²
+func (t *MPU6050) ReadAcceleration() (x, y, z float64, err error) {
+	return t.ReadAccelData()
+}
+
+// ReadAngularVelocity reads the angular velocity in degrees per second
+func (t *MPU6050) ReadAngularVelocity() (x, y, z float64, err error) {
+	return t.ReadGyroData()
+}
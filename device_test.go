@@ -0,0 +1,61 @@
+package piicodev
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDeviceInterfaces(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	clock.SetAutoAdvance(true)
+
+	// withClock opens a fake device whose waits advance the fake clock
+	withClock := func(f *FakeConn) *I2C {
+		i2c := NewI2C(f)
+		i2c.SetClock(clock)
+		return i2c
+	}
+
+	tmp117 := NewFakeConn()
+	tmp117.SetReg(0, 0x0C, 0x80)
+	lm75a := NewFakeConn()
+	lm75a.SetReg(_LM75A_REG_TEMPERATURE, 0x19, 0x00)
+
+	t1, _ := NewTMP117WithConn(tmp117)
+	t2, _ := NewLM75AWithConn(lm75a)
+
+	for _, d := range []Device{t1, t2} {
+		if temp, err := d.(Thermometer).ReadTemperature(); err != nil || math.Abs(temp-25.0) > 1e-9 {
+			t.Errorf("%s temperature is %f (%v) rather than 25", d.Name(), temp, err)
+		}
+
+		if d.Address() != 0 {
+			t.Errorf("%s address is 0x%X rather than that of the fake device", d.Name(), d.Address())
+		}
+	}
+
+	veml6040 := NewFakeConn()
+	veml6040.SetReg(VEML6040GreenReg, 0x64, 0x00)
+	l, _ := NewVEML6040WithConn(withClock(veml6040))
+
+	var meter LightMeter = l
+	if lux, err := meter.ReadIlluminance(); err != nil || math.Abs(lux-25.168) > 1e-9 {
+		t.Errorf("VEML6040 illuminance is %f (%v) rather than 25.168", lux, err)
+	}
+
+	veml6040.SetReg(VEML6040ConfigReg, 2<<_VEML6040_IT_SHIFT, 0x00)
+	if lux, err := meter.ReadIlluminance(); err != nil || math.Abs(lux-6.292) > 1e-9 {
+		t.Errorf("VEML6040 illuminance with a 160ms integration time is %f (%v) rather than 6.292", lux, err)
+	}
+
+	vl53l1x := NewFakeConn()
+	vl53l1x.SetReg16(_VL53L1X_MODEL_ID_REG, 0xEA, 0xCC)
+	vl53l1x.SetReg16(0x0089+13, 0x01, 0x2C)
+	d, _ := NewVL53L1XWithConn(withClock(vl53l1x))
+
+	var rf RangeFinder = d
+	if mm, err := rf.ReadDistance(); err != nil || mm != 300 {
+		t.Errorf("VL53L1X distance is %f (%v) rather than 300", mm, err)
+	}
+}
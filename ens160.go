@@ -2,8 +2,8 @@
 package piicodev
 
 import (
+	"context"
 	"encoding/binary"
-	"fmt"
 	"time"
 )
 
@@ -50,11 +50,26 @@ const (
 )
 
 func NewENS160(addr uint8, bus int) (s *ENS160, err error) {
-	s = new(ENS160)
-	if s.i2c, err = OpenI2C(addr, bus); err != nil {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
 		return
 	}
 
+	return NewENS160WithConn(i2c)
+}
+
+// NewENS160WithConn creates a new ENS160 instance on an already open connection
+func NewENS160WithConn(conn Conn) (s *ENS160, err error) {
+	return NewENS160WithConnContext(context.Background(), conn)
+}
+
+// NewENS160WithConnContext creates a new ENS160 instance on an already open
+// connection, stopping the waits for the startup if the context is done
+func NewENS160WithConnContext(ctx context.Context, conn Conn) (s *ENS160, err error) {
+	i2c := NewI2C(conn)
+	s = &ENS160{i2c: i2c.withContext(ctx)}
+	defer func() { s.i2c = i2c }()
+
 	// REVISIT - inten/intdat/intgpr
 	s.config = 0
 
@@ -64,7 +79,7 @@ func NewENS160(addr uint8, bus int) (s *ENS160, err error) {
 	}
 
 	if part_id != _VAL_PART_ID {
-		err = fmt.Errorf("part ID read from ENS160 is 0x%x rather than 0x%x", part_id, _VAL_PART_ID)
+		err = &DeviceIDError{Device: "ENS160", ID: part_id, Expected: []uint16{_VAL_PART_ID}}
 		return
 	}
 
@@ -72,13 +87,17 @@ func NewENS160(addr uint8, bus int) (s *ENS160, err error) {
 		return
 	}
 
-	time.Sleep(20 * time.Millisecond)
+	if err = s.i2c.sleep(ctx, 20*time.Millisecond); err != nil {
+		return
+	}
 
 	if _, err = s.i2c.ReadRegU8(_REG_OPMODE); err != nil {
 		return
 	}
 
-	time.Sleep(20 * time.Millisecond)
+	if err = s.i2c.sleep(ctx, 20*time.Millisecond); err != nil {
+		return
+	}
 
 	if err = s.i2c.WriteRegU8(_REG_CONFIG, s.config); err != nil {
 		return
@@ -88,6 +107,9 @@ func NewENS160(addr uint8, bus int) (s *ENS160, err error) {
 }
 
 func (s *ENS160) readData() (err error) {
+	s.i2c.Lock()
+	defer s.i2c.Unlock()
+
 	var status byte
 	if status, err = s.i2c.ReadRegU8(_REG_DEVICE_STATUS); err != nil {
 		return
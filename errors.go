@@ -0,0 +1,193 @@
+// Errors returned by the I2C layer and the drivers
+package piicodev
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+var (
+	// ErrNoDevice is matched by errors for transactions that were not acknowledged (ENXIO or EREMOTEIO)
+	ErrNoDevice = errors.New("no device at the I2C address")
+
+	// ErrBusy is matched by errors for an address or bus that is in use (EBUSY)
+	ErrBusy = errors.New("I2C address or bus is busy")
+
+	// ErrTimeout is matched by errors for a bus or device that did not respond in time
+	ErrTimeout = errors.New("timeout waiting for the I2C device")
+
+	// ErrWrongDevice is matched by errors for a device with an unexpected identity
+	ErrWrongDevice = errors.New("unexpected I2C device identity")
+
+	// ErrChecksum is matched by errors for data that failed a checksum, including an SMBus PEC (EBADMSG)
+	ErrChecksum = errors.New("I2C data checksum failed")
+
+	// ErrNotSupported is returned for an operation that the connection or adapter does not support
+	ErrNotSupported = errors.New("operation not supported by the I2C connection")
+
+	// ErrInvalidLength is matched by errors for data too long for an I2C message or an SMBus block
+	ErrInvalidLength = errors.New("data too long for the I2C transaction")
+)
+
+// I2CError is a failed I2C transaction with a device on a bus
+type I2CError struct {
+	Op      string // the operation: one of the Op constants of a Transaction, "set address" or "enable PEC for"
+	Bus     int
+	Address uint16
+	TenBit  bool // the address is a 10-bit address
+	Reg     int  // the register address or -1 if the operation was not on a register
+	Errno   syscall.Errno
+}
+
+func (e *I2CError) Error() string {
+	var b strings.Builder
+
+	switch e.Op {
+	case OpRead:
+		b.WriteString("failed to read from I2C")
+	case OpWrite:
+		b.WriteString("failed to write to I2C")
+	case OpSMBusRead:
+		b.WriteString("failed to read from SMBus")
+	case OpSMBusWrite:
+		b.WriteString("failed to write to SMBus")
+	default:
+		fmt.Fprintf(&b, "failed to %s I2C", e.Op)
+	}
+
+	if e.Reg >= 0 {
+		fmt.Fprintf(&b, " register 0x%X", e.Reg)
+	}
+
+	fmt.Fprintf(&b, " at %s on bus %d: %s", formatAddress(e.Address, e.TenBit), e.Bus, e.Errno.Error())
+	return b.String()
+}
+
+// Unwrap returns the errno so errors.Is can match syscall errors such as syscall.EREMOTEIO
+func (e *I2CError) Unwrap() error {
+	return e.Errno
+}
+
+// formatAddress formats a 7-bit or 10-bit address for an error message
+func formatAddress(address uint16, tenBit bool) string {
+	if tenBit {
+		return fmt.Sprintf("10-bit address 0x%03X", address)
+	}
+
+	return fmt.Sprintf("address 0x%X", address)
+}
+
+// Is matches the sentinel errors for classes of errno
+func (e *I2CError) Is(target error) bool {
+	return errnoIs(e.Errno, target)
+}
+
+// errnoIs matches the sentinel errors for classes of errno
+func errnoIs(errno syscall.Errno, target error) bool {
+	switch target {
+	case ErrNoDevice:
+		return errno == syscall.ENXIO || errno == syscall.EREMOTEIO
+	case ErrBusy:
+		return errno == syscall.EBUSY
+	case ErrTimeout:
+		return errno == syscall.ETIMEDOUT
+	case ErrChecksum:
+		return errno == syscall.EBADMSG
+	case ErrNotSupported:
+		return errno == syscall.EOPNOTSUPP
+	}
+
+	return false
+}
+
+// BusError is a failed operation on an I2C bus rather than with a device on it
+type BusError struct {
+	Op    string // the operation, such as "query the functionality of"
+	Bus   int
+	Errno syscall.Errno
+}
+
+func (e *BusError) Error() string {
+	return fmt.Sprintf("failed to %s I2C bus %d: %s", e.Op, e.Bus, e.Errno.Error())
+}
+
+// Unwrap returns the errno so errors.Is can match syscall errors
+func (e *BusError) Unwrap() error {
+	return e.Errno
+}
+
+// Is matches the sentinel errors for classes of errno
+func (e *BusError) Is(target error) bool {
+	return errnoIs(e.Errno, target)
+}
+
+// DeviceIDError is a device that returned an unexpected identity when a driver was created
+type DeviceIDError struct {
+	Device   string   // the device type of the driver
+	ID       uint16   // the identity read from the device
+	Expected []uint16 // the identities supported by the driver
+}
+
+func (e *DeviceIDError) Error() string {
+	expected := make([]string, len(e.Expected))
+	for i, id := range e.Expected {
+		expected[i] = fmt.Sprintf("0x%X", id)
+	}
+
+	return fmt.Sprintf("the %s device ID is 0x%X rather than %s", e.Device, e.ID, strings.Join(expected, " or "))
+}
+
+// Is matches ErrWrongDevice
+func (e *DeviceIDError) Is(target error) bool {
+	return target == ErrWrongDevice
+}
+
+// ChecksumError is data read from a device that failed a checksum
+type ChecksumError struct {
+	Device string // the device type of the driver
+	CRC    uint32 // the calculated checksum
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("the calculated CRC of %s sensor data is not zero: 0x%X", e.Device, e.CRC)
+}
+
+// Is matches ErrChecksum
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksum
+}
+
+// TimeoutError is a device that did not complete an operation in time
+type TimeoutError struct {
+	Device string // the device type of the driver
+	Op     string // the operation that was waited on
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("timeout waiting for %s %s to complete", e.Device, e.Op)
+}
+
+// Is matches ErrTimeout
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// KernelDriverError is an address that cannot be used as a kernel driver is bound to it
+type KernelDriverError struct {
+	Bus     int
+	Address uint16
+	TenBit  bool
+	Driver  string // the name of the kernel driver, e.g. "lm75"
+	Err     error  // the error setting the address
+}
+
+func (e *KernelDriverError) Error() string {
+	return fmt.Sprintf("I2C %s on bus %d is in use by the kernel driver %s, unbind the driver or open the device with force", formatAddress(e.Address, e.TenBit), e.Bus, e.Driver)
+}
+
+// Unwrap returns the error setting the address, which matches ErrBusy
+func (e *KernelDriverError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,56 @@
+package piicodev
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+)
+
+func TestI2CError(t *testing.T) {
+	err := error(&I2CError{Op: "read", Bus: 1, Address: 0x48, Reg: 0x0F, Errno: syscall.EREMOTEIO})
+
+	if msg := err.Error(); msg != "failed to read from I2C register 0xF at address 0x48 on bus 1: "+syscall.EREMOTEIO.Error() {
+		t.Errorf("Unexpected error message: %s", msg)
+	}
+
+	if !errors.Is(err, ErrNoDevice) || !errors.Is(err, syscall.EREMOTEIO) || errors.Is(err, ErrBusy) {
+		t.Errorf("I2C error with EREMOTEIO did not match the expected errors")
+	}
+
+	var i2cErr *I2CError
+	if !errors.As(err, &i2cErr) || i2cErr.Address != 0x48 || i2cErr.Reg != 0x0F {
+		t.Errorf("I2C error did not carry the address and register")
+	}
+
+	busy := &I2CError{Op: "set address", Bus: 1, Address: 0x48, Reg: -1, Errno: syscall.EBUSY}
+	if !errors.Is(busy, ErrBusy) || errors.Is(busy, ErrNoDevice) {
+		t.Errorf("I2C error with EBUSY did not match ErrBusy")
+	}
+}
+
+func TestDriverErrors(t *testing.T) {
+	sw := NewFakeConn()
+	sw.SetReg(_SWITCH_REG_WHOAMI, 0x01, 0x7B)
+
+	_, err := NewSwitchWithConn(sw)
+	var idErr *DeviceIDError
+	if !errors.Is(err, ErrWrongDevice) || !errors.As(err, &idErr) || idErr.ID != _DEVICE_ID_POT {
+		t.Errorf("Potentiometer opened as a switch returned %v", err)
+	}
+
+	aht := NewFakeConn()
+	s, err := NewAHT10WithConn(aht)
+	if err != nil {
+		t.Fatalf("Error while creating the AHT10: %v", err)
+	}
+
+	aht.SetReg(_AHTXX_REG_STATUS, 0x1C, 0x80, 0x00, 0x05, 0x66, 0x66, 0x00)
+	if _, _, err = s.ReadSensor(); !errors.Is(err, ErrChecksum) {
+		t.Errorf("AHT10 data with a bad CRC returned %v", err)
+	}
+
+	aht.SetReg(_AHTXX_REG_STATUS, _AHTXX_STATUS_CTRL_BUSY)
+	if _, _, err = s.ReadSensor(); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Busy AHT10 returned %v", err)
+	}
+}
@@ -0,0 +1,458 @@
+// In-memory fake I2C device for testing drivers without hardware
+package piicodev
+
+import (
+	"sync"
+)
+
+// FakeTx is a single transaction seen by a FakeConn. Writes only have Write set
+// while register reads have the register address bytes in Write and the bytes
+// returned in Read.
+type FakeTx struct {
+	Write []byte
+	Read  []byte
+}
+
+// FakeConn is a Conn backed by an in-memory register map. It models separate
+// 8-bit (ReadReg/WriteReg) and 16-bit (ReadReg16/WriteReg16) register address
+// spaces with auto-incrementing addresses for multi-byte accesses. Transfer
+// messages use the 8-bit space like a typical register device: a write sets the
+// register pointer to its first byte and stores the rest, and a read continues
+// from the register pointer. It supports scripted read responses and injected
+// errors, and logs every transaction so tests can assert the exact bytes a driver
+// sends.
+type FakeConn struct {
+	mu      sync.Mutex
+	regs    [256]byte
+	regs16  map[uint16]byte
+	queued  map[uint32][][]byte
+	errs    []error
+	log     []FakeTx
+	ptr     byte
+	pec     bool
+	address uint16
+	closed  bool
+}
+
+// NewFakeConn creates a fake device with all registers set to zero
+func NewFakeConn() *FakeConn {
+	return &FakeConn{
+		regs16: make(map[uint16]byte),
+		queued: make(map[uint32][][]byte),
+	}
+}
+
+// queueKey separates the 8-bit and 16-bit register spaces in the queued responses
+func queueKey(reg uint16, is16 bool) uint32 {
+	if is16 {
+		return 1<<16 | uint32(reg)
+	}
+
+	return uint32(reg)
+}
+
+// SetReg sets consecutive registers starting at an 8-bit register address
+func (f *FakeConn) SetReg(reg byte, val ...byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, v := range val {
+		f.regs[byte(int(reg)+i)] = v
+	}
+}
+
+// SetReg16 sets consecutive registers starting at a 16-bit register address
+func (f *FakeConn) SetReg16(reg uint16, val ...byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, v := range val {
+		f.regs16[reg+uint16(i)] = v
+	}
+}
+
+// Reg returns length registers starting at an 8-bit register address
+func (f *FakeConn) Reg(reg byte, length int) (val []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	val = make([]byte, length)
+	for i := range val {
+		val[i] = f.regs[byte(int(reg)+i)]
+	}
+
+	return
+}
+
+// Reg16 returns length registers starting at a 16-bit register address
+func (f *FakeConn) Reg16(reg uint16, length int) (val []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	val = make([]byte, length)
+	for i := range val {
+		val[i] = f.regs16[reg+uint16(i)]
+	}
+
+	return
+}
+
+// QueueReadReg scripts the responses of the next reads of an 8-bit register address.
+// Each response is returned once, in order, before falling back to the register map.
+func (f *FakeConn) QueueReadReg(reg byte, responses ...[]byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	k := queueKey(uint16(reg), false)
+	f.queued[k] = append(f.queued[k], responses...)
+}
+
+// QueueReadReg16 scripts the responses of the next reads of a 16-bit register address
+func (f *FakeConn) QueueReadReg16(reg uint16, responses ...[]byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	k := queueKey(reg, true)
+	f.queued[k] = append(f.queued[k], responses...)
+}
+
+// QueueError makes the next transaction fail with err. Multiple errors fail consecutive transactions.
+func (f *FakeConn) QueueError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.errs = append(f.errs, err)
+}
+
+// Log returns a copy of every transaction made since creation or the last ClearLog
+func (f *FakeConn) Log() (log []FakeTx) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	log = make([]FakeTx, len(f.log))
+	copy(log, f.log)
+	return
+}
+
+// Writes returns the bytes of every write-only transaction in order
+func (f *FakeConn) Writes() (writes [][]byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, tx := range f.log {
+		if tx.Read == nil {
+			writes = append(writes, tx.Write)
+		}
+	}
+
+	return
+}
+
+// ClearLog discards the logged transactions
+func (f *FakeConn) ClearLog() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.log = nil
+}
+
+// IsClosed reports whether Close has been called
+func (f *FakeConn) IsClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.closed
+}
+
+// nextError pops an injected error, must be called with the lock held
+func (f *FakeConn) nextError() (err error) {
+	if len(f.errs) > 0 {
+		err = f.errs[0]
+		f.errs = f.errs[1:]
+	}
+
+	return
+}
+
+// read serves a register read into val from the queued responses or the register map
+func (f *FakeConn) read(reg uint16, is16 bool, val []byte) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err = f.nextError(); err != nil {
+		return
+	}
+
+	k := queueKey(reg, is16)
+	if q := f.queued[k]; len(q) > 0 {
+		for i := copy(val, q[0]); i < len(val); i++ {
+			val[i] = 0
+		}
+
+		if len(q) == 1 {
+			delete(f.queued, k)
+		} else {
+			f.queued[k] = q[1:]
+		}
+	} else {
+		for i := range val {
+			if is16 {
+				val[i] = f.regs16[reg+uint16(i)]
+			} else {
+				val[i] = f.regs[byte(int(reg)+i)]
+			}
+		}
+	}
+
+	var addr []byte
+	if is16 {
+		addr = []byte{byte(reg >> 8), byte(reg)}
+	} else {
+		addr = []byte{byte(reg)}
+	}
+
+	f.log = append(f.log, FakeTx{Write: addr, Read: append([]byte{}, val...)})
+	return
+}
+
+// write logs the bytes on the wire and stores the data in the register map
+func (f *FakeConn) write(msg []byte, reg uint16, regBytes int, val []byte) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err = f.nextError(); err != nil {
+		return
+	}
+
+	f.log = append(f.log, FakeTx{Write: msg})
+
+	for i, v := range val {
+		switch regBytes {
+		case 1:
+			f.regs[byte(int(reg)+i)] = v
+		case 2:
+			f.regs16[reg+uint16(i)] = v
+		}
+	}
+
+	return
+}
+
+// Transfer reads and writes the 8-bit register address space from the register
+// pointer. A write message followed by read messages is logged as one FakeTx.
+func (f *FakeConn) Transfer(msgs ...Msg) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err = f.nextError(); err != nil {
+		return
+	}
+
+	for i, m := range msgs {
+		if !m.Read {
+			tx := FakeTx{Write: append([]byte{}, m.Data...)}
+			if len(m.Data) > 0 {
+				f.ptr = m.Data[0]
+				for _, v := range m.Data[1:] {
+					f.regs[f.ptr] = v
+					f.ptr++
+				}
+			}
+
+			if i+1 < len(msgs) && msgs[i+1].Read {
+				tx.Read = []byte{}
+			}
+
+			f.log = append(f.log, tx)
+			continue
+		}
+
+		k := queueKey(uint16(f.ptr), false)
+		if q := f.queued[k]; len(q) > 0 {
+			for j := copy(m.Data, q[0]); j < len(m.Data); j++ {
+				m.Data[j] = 0
+			}
+
+			if len(q) == 1 {
+				delete(f.queued, k)
+			} else {
+				f.queued[k] = q[1:]
+			}
+			f.ptr += byte(len(m.Data))
+		} else {
+			for j := range m.Data {
+				m.Data[j] = f.regs[f.ptr]
+				f.ptr++
+			}
+		}
+
+		if i > 0 && f.log[len(f.log)-1].Read != nil {
+			last := &f.log[len(f.log)-1]
+			last.Read = append(last.Read, m.Data...)
+		} else {
+			f.log = append(f.log, FakeTx{Read: append([]byte{}, m.Data...)})
+		}
+	}
+
+	return
+}
+
+// SMBus emulates an SMBus transaction on the 8-bit register address space. The
+// command is the register address, a byte without a command uses the register
+// pointer, and a block read returns the length of the block from the register of
+// the command followed by the data from the registers after it.
+func (f *FakeConn) SMBus(read bool, command byte, protocol SMBusProtocol, data []byte) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err = f.nextError(); err != nil {
+		return
+	}
+
+	switch protocol {
+	case SMBusQuick:
+		f.log = append(f.log, FakeTx{Write: []byte{}})
+	case SMBusByte:
+		if read {
+			data[0] = f.regs[f.ptr]
+			f.log = append(f.log, FakeTx{Read: []byte{data[0]}})
+			f.ptr++
+		} else {
+			f.ptr = command
+			f.log = append(f.log, FakeTx{Write: []byte{command}})
+		}
+	case SMBusByteData, SMBusWordData, SMBusProcCall:
+		n := 1
+		if protocol != SMBusByteData {
+			n = 2
+		}
+
+		if !read {
+			for i := 0; i < n; i++ {
+				f.regs[command+byte(i)] = data[i]
+			}
+
+			f.log = append(f.log, FakeTx{Write: append([]byte{command}, data[:n]...)})
+		}
+
+		if read || protocol == SMBusProcCall {
+			for i := 0; i < n; i++ {
+				data[i] = f.regs[command+byte(i)]
+			}
+
+			f.log = append(f.log, FakeTx{Write: []byte{command}, Read: append([]byte{}, data[:n]...)})
+		}
+	case SMBusBlockData:
+		if read {
+			n := int(f.regs[command])
+			if n > I2C_SMBUS_BLOCK_MAX {
+				n = I2C_SMBUS_BLOCK_MAX
+			}
+
+			for i := 0; i <= n; i++ {
+				data[i] = f.regs[command+byte(i)]
+			}
+			data[0] = byte(n)
+
+			f.log = append(f.log, FakeTx{Write: []byte{command}, Read: append([]byte{}, data[:n+1]...)})
+		} else {
+			n := int(data[0])
+			for i := 0; i <= n; i++ {
+				f.regs[command+byte(i)] = data[i]
+			}
+
+			f.log = append(f.log, FakeTx{Write: append([]byte{command}, data[:n+1]...)})
+		}
+	default:
+		err = ErrNotSupported
+	}
+
+	return
+}
+
+// SetPEC records whether packet error checking is enabled
+func (f *FakeConn) SetPEC(on bool) (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.pec = on
+	return
+}
+
+// PEC reports whether packet error checking has been enabled with SetPEC
+func (f *FakeConn) PEC() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.pec
+}
+
+// ReadReg reads from the 8-bit register address space
+func (f *FakeConn) ReadReg(reg byte, length int) (val []byte, err error) {
+	val = make([]byte, length)
+	if err = f.read(uint16(reg), false, val); err != nil {
+		val = nil
+	}
+
+	return
+}
+
+// ReadReg16 reads from the 16-bit register address space
+func (f *FakeConn) ReadReg16(reg uint16, length int) (val []byte, err error) {
+	val = make([]byte, length)
+	if err = f.read(reg, true, val); err != nil {
+		val = nil
+	}
+
+	return
+}
+
+// ReadRegInto reads from the 8-bit register address space into buf
+func (f *FakeConn) ReadRegInto(reg byte, buf []byte) (err error) {
+	return f.read(uint16(reg), false, buf)
+}
+
+// ReadReg16Into reads from the 16-bit register address space into buf
+func (f *FakeConn) ReadReg16Into(reg uint16, buf []byte) (err error) {
+	return f.read(reg, true, buf)
+}
+
+// Write logs a raw write without changing any registers
+func (f *FakeConn) Write(val []byte) (err error) {
+	return f.write(append([]byte{}, val...), 0, 0, nil)
+}
+
+// WriteReg writes to the 8-bit register address space
+func (f *FakeConn) WriteReg(reg byte, val []byte) (err error) {
+	return f.write(append([]byte{reg}, val...), uint16(reg), 1, val)
+}
+
+// WriteReg16 writes to the 16-bit register address space
+func (f *FakeConn) WriteReg16(reg uint16, val []byte) (err error) {
+	return f.write(append([]byte{byte(reg >> 8), byte(reg)}, val...), reg, 2, val)
+}
+
+// Close marks the fake device as closed
+func (f *FakeConn) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+}
+
+// withAddress moves the fake device to another address
+func (f *FakeConn) withAddress(address uint8) Conn {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.address = uint16(address)
+	return f
+}
+
+// Address returns the address of the fake device, which is 0 unless it has been moved
+func (f *FakeConn) Address() uint16 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.address
+}
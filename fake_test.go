@@ -0,0 +1,165 @@
+package piicodev
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestFakeConnRegisterSpaces(t *testing.T) {
+	f := NewFakeConn()
+	i2c := NewI2C(f)
+
+	if err := i2c.WriteRegU16BE(0x10, 0x1234); err != nil {
+		t.Fatalf("Error writing 8-bit register: %v", err)
+	}
+
+	if err := i2c.WriteReg16U16BE(0x0010, 0xABCD); err != nil {
+		t.Fatalf("Error writing 16-bit register: %v", err)
+	}
+
+	if v, err := i2c.ReadRegU16BE(0x10); err != nil || v != 0x1234 {
+		t.Errorf("8-bit register 0x10 is 0x%X (%v) rather than 0x1234", v, err)
+	}
+
+	if v, err := i2c.ReadReg16U16BE(0x0010); err != nil || v != 0xABCD {
+		t.Errorf("16-bit register 0x0010 is 0x%X (%v) rather than 0xABCD", v, err)
+	}
+
+	f.QueueReadReg(0x10, []byte{0x01, 0x02}, []byte{0x03, 0x04})
+	for _, want := range []uint16{0x0102, 0x0304, 0x1234} {
+		if v, _ := i2c.ReadRegU16BE(0x10); v != want {
+			t.Errorf("Scripted read of 0x10 is 0x%X rather than 0x%X", v, want)
+		}
+	}
+
+	injected := errors.New("injected")
+	f.QueueError(injected)
+	if _, err := i2c.ReadRegU8(0x10); err != injected {
+		t.Errorf("Expected the injected error but got %v", err)
+	}
+
+	i2c.Close()
+	if !f.IsClosed() {
+		t.Errorf("Fake device was not closed")
+	}
+}
+
+func TestFakeVL53L1X(t *testing.T) {
+	f := NewFakeConn()
+	f.SetReg16(0x010F, 0xEA, 0xCC)
+	f.SetReg16(0x0022, 0x01, 0x02)
+
+	d, err := NewVL53L1XWithConn(f)
+	if err != nil {
+		t.Fatalf("Error while creating the VL53L1X: %v", err)
+	}
+
+	expected := [][]byte{
+		{0x00, 0x00, 0x00},
+		{0x00, 0x00, 0x01},
+		append([]byte{0x00, 0x2D}, _VL51L1X_DEFAULT_CONFIGURATION...),
+		{0x00, 0x1E, 0x04, 0x08},
+	}
+
+	writes := f.Writes()
+	if len(writes) != len(expected) {
+		t.Fatalf("VL53L1X initialisation made %d writes rather than %d", len(writes), len(expected))
+	}
+
+	for i := range expected {
+		if !bytes.Equal(writes[i], expected[i]) {
+			t.Errorf("VL53L1X write %d was %X rather than %X", i, writes[i], expected[i])
+		}
+	}
+
+	f.SetReg16(0x0089+13, 0x01, 0x2C)
+	var rng uint16
+	if rng, err = d.Read(); err != nil || rng != 300 {
+		t.Errorf("VL53L1X range is %d (%v) rather than 300", rng, err)
+	}
+}
+
+func TestFakeENS160(t *testing.T) {
+	f := NewFakeConn()
+	f.SetReg(_REG_PART_ID, 0x60, 0x01)
+
+	s, err := NewENS160WithConn(f)
+	if err != nil {
+		t.Fatalf("Error while creating the ENS160: %v", err)
+	}
+
+	expected := [][]byte{
+		{_REG_OPMODE, _VAL_OPMODE_STANDARD},
+		{_REG_CONFIG, 0x00},
+	}
+
+	writes := f.Writes()
+	if len(writes) != len(expected) {
+		t.Fatalf("ENS160 initialisation made %d writes rather than %d", len(writes), len(expected))
+	}
+
+	for i := range expected {
+		if !bytes.Equal(writes[i], expected[i]) {
+			t.Errorf("ENS160 write %d was %X rather than %X", i, writes[i], expected[i])
+		}
+	}
+
+	f.SetReg(_REG_DEVICE_STATUS, 1<<_BIT_DEVICE_STATUS_NEWDAT, 2, 0x34, 0x12, 0x20, 0x03)
+
+	var eco2 uint16
+	var rating string
+	if eco2, rating, err = s.ReadECO2(); err != nil || eco2 != 800 || rating != "good" {
+		t.Errorf("ENS160 eCO2 is %d %s (%v) rather than 800 good", eco2, rating, err)
+	}
+
+	var tvoc uint16
+	if tvoc, err = s.ReadTVOC(); err != nil || tvoc != 0x1234 {
+		t.Errorf("ENS160 TVOC is 0x%X (%v) rather than 0x1234", tvoc, err)
+	}
+
+	if _, err = NewENS160WithConn(NewFakeConn()); err == nil {
+		t.Errorf("Expected an error for an ENS160 with the wrong part ID")
+	}
+}
+
+func TestFakeTMP117(t *testing.T) {
+	f := NewFakeConn()
+	s, _ := NewTMP117WithConn(f)
+
+	for _, tc := range []struct {
+		raw   []byte
+		tempC float64
+	}{
+		{[]byte{0x0C, 0x80}, 25.0},
+		{[]byte{0xFF, 0x80}, -1.0},
+	} {
+		f.SetReg(0, tc.raw...)
+		if tempC, err := s.ReadTempC(); err != nil || math.Abs(tempC-tc.tempC) > 1e-9 {
+			t.Errorf("TMP117 temperature for %X is %f (%v) rather than %f", tc.raw, tempC, err, tc.tempC)
+		}
+	}
+}
+
+func TestFakeMPU6050(t *testing.T) {
+	f := NewFakeConn()
+	f.SetReg(WHO_AM_I, WHO_AM_I_VALUE)
+
+	m, err := NewMPU6050WithConn(f)
+	if err != nil {
+		t.Fatalf("Error while creating the MPU6050: %v", err)
+	}
+
+	f.SetReg(ACCEL_XOUT0, 0x40, 0x00, 0xC0, 0x00, 0x00, 0x00)
+	f.ClearLog()
+
+	var x, y, z float64
+	if x, y, z, err = m.ReadAccelData(); err != nil || math.Abs(x-GRAVITIY_MS2) > 1e-9 || math.Abs(y+GRAVITIY_MS2) > 1e-9 || z != 0 {
+		t.Errorf("MPU6050 acceleration is %f %f %f (%v) rather than 1g -1g 0", x, y, z, err)
+	}
+
+	if log := f.Log(); len(log) != 2 || len(log[1].Read) != 6 {
+		t.Errorf("MPU6050 acceleration was not read in a single transaction: %v", log)
+	}
+}
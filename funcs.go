@@ -0,0 +1,187 @@
+// Adapter functionality and kernel-level settings of an I2C bus
+package piicodev
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	I2C_RETRIES uintptr = 0x0701
+	I2C_TIMEOUT uintptr = 0x0702
+	I2C_FUNCS   uintptr = 0x0705
+)
+
+// Functionality is the set of I2C_FUNC flags of an adapter from the I2C_FUNCS ioctl
+type Functionality uint64
+
+const (
+	FuncI2C                 Functionality = 0x00000001 // plain I2C messages (I2C_RDWR)
+	Func10BitAddr           Functionality = 0x00000002
+	FuncProtocolMangling    Functionality = 0x00000004
+	FuncSMBusPEC            Functionality = 0x00000008
+	FuncNoStart             Functionality = 0x00000010
+	FuncSlave               Functionality = 0x00000020
+	FuncSMBusBlockProcCall  Functionality = 0x00008000
+	FuncSMBusQuick          Functionality = 0x00010000
+	FuncSMBusReadByte       Functionality = 0x00020000
+	FuncSMBusWriteByte      Functionality = 0x00040000
+	FuncSMBusReadByteData   Functionality = 0x00080000
+	FuncSMBusWriteByteData  Functionality = 0x00100000
+	FuncSMBusReadWordData   Functionality = 0x00200000
+	FuncSMBusWriteWordData  Functionality = 0x00400000
+	FuncSMBusProcCall       Functionality = 0x00800000
+	FuncSMBusReadBlockData  Functionality = 0x01000000
+	FuncSMBusWriteBlockData Functionality = 0x02000000
+	FuncSMBusReadI2CBlock   Functionality = 0x04000000
+	FuncSMBusWriteI2CBlock  Functionality = 0x08000000
+	FuncSMBusHostNotify     Functionality = 0x10000000
+)
+
+var functionalityNames = []struct {
+	f    Functionality
+	name string
+}{
+	{FuncI2C, "I2C"},
+	{Func10BitAddr, "10-bit addresses"},
+	{FuncProtocolMangling, "protocol mangling"},
+	{FuncSMBusPEC, "SMBus PEC"},
+	{FuncNoStart, "no start"},
+	{FuncSlave, "slave"},
+	{FuncSMBusBlockProcCall, "SMBus block process call"},
+	{FuncSMBusQuick, "SMBus quick"},
+	{FuncSMBusReadByte, "SMBus read byte"},
+	{FuncSMBusWriteByte, "SMBus write byte"},
+	{FuncSMBusReadByteData, "SMBus read byte data"},
+	{FuncSMBusWriteByteData, "SMBus write byte data"},
+	{FuncSMBusReadWordData, "SMBus read word data"},
+	{FuncSMBusWriteWordData, "SMBus write word data"},
+	{FuncSMBusProcCall, "SMBus process call"},
+	{FuncSMBusReadBlockData, "SMBus read block data"},
+	{FuncSMBusWriteBlockData, "SMBus write block data"},
+	{FuncSMBusReadI2CBlock, "SMBus read I2C block"},
+	{FuncSMBusWriteI2CBlock, "SMBus write I2C block"},
+	{FuncSMBusHostNotify, "SMBus host notify"},
+}
+
+// Has checks whether all of the flags are supported
+func (f Functionality) Has(flags Functionality) bool {
+	return f&flags == flags
+}
+
+func (f Functionality) String() string {
+	var names []string
+	for _, n := range functionalityNames {
+		if f.Has(n.f) {
+			names = append(names, n.name)
+			f &^= n.f
+		}
+	}
+
+	if f != 0 {
+		names = append(names, fmt.Sprintf("0x%X", uint64(f)))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// smbusFunctionality returns the flag needed for an SMBus transaction
+func smbusFunctionality(read bool, protocol SMBusProtocol) Functionality {
+	switch protocol {
+	case SMBusQuick:
+		return FuncSMBusQuick
+	case SMBusByte:
+		if read {
+			return FuncSMBusReadByte
+		}
+		return FuncSMBusWriteByte
+	case SMBusByteData:
+		if read {
+			return FuncSMBusReadByteData
+		}
+		return FuncSMBusWriteByteData
+	case SMBusWordData:
+		if read {
+			return FuncSMBusReadWordData
+		}
+		return FuncSMBusWriteWordData
+	case SMBusProcCall:
+		return FuncSMBusProcCall
+	case SMBusBlockData:
+		if read {
+			return FuncSMBusReadBlockData
+		}
+		return FuncSMBusWriteBlockData
+	case SMBusBlockProcCall:
+		return FuncSMBusBlockProcCall
+	case SMBusI2CBlockData:
+		if read {
+			return FuncSMBusReadI2CBlock
+		}
+		return FuncSMBusWriteI2CBlock
+	}
+
+	return 0
+}
+
+// queryFunctionality reads the functionality of the adapter with I2C_FUNCS
+func (b *Bus) queryFunctionality() (errno syscall.Errno) {
+	var funcs uint // unsigned long
+	if errno = ioctlPtr(b.dev, I2C_FUNCS, unsafe.Pointer(&funcs)); errno == 0 {
+		b.funcs = Functionality(funcs)
+	}
+
+	return
+}
+
+// Functionality returns what the adapter supports, as queried when the bus was opened.
+// Transactions that the adapter does not support fail with an error matching ErrNotSupported.
+func (b *Bus) Functionality() Functionality {
+	return b.funcs
+}
+
+// SetAdapterTimeout sets the timeout of the adapter driver in the kernel for a
+// transaction with I2C_TIMEOUT. The kernel uses units of 10 milliseconds.
+func (b *Bus) SetAdapterTimeout(d time.Duration) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errno := ioctl(b.dev, I2C_TIMEOUT, uintptr((d+10*time.Millisecond-1)/(10*time.Millisecond))); errno != 0 {
+		err = &BusError{Op: "set the timeout of", Bus: b.bus, Errno: errno}
+	}
+
+	return
+}
+
+// SetAdapterRetries sets the number of times the adapter driver in the kernel
+// retries a transaction that is not acknowledged with I2C_RETRIES. These retries
+// are made by the kernel before the RetryPolicy of the device.
+func (b *Bus) SetAdapterRetries(n int) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if errno := ioctl(b.dev, I2C_RETRIES, uintptr(n)); errno != 0 {
+		err = &BusError{Op: "set the retries of", Bus: b.bus, Errno: errno}
+	}
+
+	return
+}
+
+// Functionality returns what the adapter of the device supports, failing with
+// ErrNotSupported if the connection is not to a device on an adapter
+func (i2c *I2C) Functionality() (f Functionality, err error) {
+	d, ok := i2c.Conn.(interface{ Functionality() Functionality })
+	if !ok {
+		return 0, ErrNotSupported
+	}
+
+	return d.Functionality(), nil
+}
+
+// Functionality returns what the adapter of the device supports
+func (d *devConn) Functionality() Functionality {
+	return d.bus.funcs
+}
@@ -2,152 +2,626 @@
 package piicodev
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
-	"os"
-	"reflect"
+	"sync"
 	"syscall"
-	"unsafe"
 )
 
-const (
-	I2C_SLAVE uintptr = 0x0703
-	I2C_RDWR  uintptr = 0x0707
-)
+// Conn is an open connection to a single device on an I2C bus. The drivers
+// only need these primitives, so any transport (a Linux /dev/i2c device, a
+// fake for testing, a wrapper) can be used by implementing Conn. Connections
+// must not retain the slices passed to them after returning.
+type Conn interface {
+	// ReadReg reads length bytes from a register with an 8-bit address
+	ReadReg(reg byte, length int) (val []byte, err error)
+
+	// ReadReg16 reads length bytes from a register with a 16-bit address
+	ReadReg16(reg uint16, length int) (val []byte, err error)
+
+	// Write writes raw bytes to the device
+	Write(val []byte) (err error)
+
+	// WriteReg writes bytes to a register with an 8-bit address
+	WriteReg(reg byte, val []byte) (err error)
+
+	// WriteReg16 writes bytes to a register with a 16-bit address
+	WriteReg16(reg uint16, val []byte) (err error)
+
+	// Close releases the connection
+	Close()
+}
+
+// Msg is a single message of a combined transaction. A write message sends Data
+// to the device while a read message fills Data with len(Data) bytes from it.
+type Msg struct {
+	Read bool
+	Data []byte
+}
+
+// IntoReader is implemented by connections that can read a register into a
+// buffer supplied by the caller rather than allocating one
+type IntoReader interface {
+	// ReadRegInto fills buf from a register with an 8-bit address
+	ReadRegInto(reg byte, buf []byte) (err error)
+
+	// ReadReg16Into fills buf from a register with a 16-bit address
+	ReadReg16Into(reg uint16, buf []byte) (err error)
+}
 
+// Transferer is implemented by connections that can submit any sequence of read
+// and write messages as one combined transaction with repeated starts
+type Transferer interface {
+	Transfer(msgs ...Msg) (err error)
+}
+
+// I2C provides the typed register access used by the drivers on top of a Conn
 type I2C struct {
-	dev     *os.File
-	address uint8
+	retries uint64 // first for 64-bit alignment of atomic access on 32-bit platforms
+	Conn
+	mu     sync.Mutex
+	cfgMu  sync.Mutex
+	retry  *RetryPolicy
+	tracer Tracer
+	clock  Clock
+	bufMu  sync.Mutex
+	buf    [4]byte         // scratch buffer for the typed helpers
+	ctx    context.Context // stops the retry backoffs of a handle from withContext
+	parent *I2C            // the device of a handle from withContext
+}
+
+// NewI2C wraps an already open connection for use by the drivers
+func NewI2C(conn Conn) *I2C {
+	if i2c, ok := conn.(*I2C); ok {
+		return i2c
+	}
+
+	return &I2C{Conn: conn}
 }
 
-type i2c_msg struct {
-	addr  uint16
-	flags uint16
-	len   uint16
-	buf   uintptr
+// withConn returns a handle to another connection with the same retry policy,
+// tracer and clock
+func (i2c *I2C) withConn(conn Conn) (wrapped *I2C) {
+	wrapped = &I2C{Conn: conn}
+
+	i2c = i2c.device()
+	i2c.cfgMu.Lock()
+	wrapped.retry, wrapped.tracer, wrapped.clock = i2c.retry, i2c.tracer, i2c.clock
+	i2c.cfgMu.Unlock()
+
+	return
+}
+
+// withContext returns a handle to the device for the blocking operations of a
+// driver, whose retry backoffs stop waiting when the context is done. It shares
+// the lock, configuration and retry count of the device.
+func (i2c *I2C) withContext(ctx context.Context) *I2C {
+	if ctx.Done() == nil {
+		return i2c
+	}
+
+	i2c = i2c.device()
+	return &I2C{Conn: i2c.Conn, ctx: ctx, parent: i2c}
+}
+
+// device returns the device of a handle from withContext
+func (i2c *I2C) device() *I2C {
+	if i2c.parent != nil {
+		return i2c.parent
+	}
+
+	return i2c
+}
+
+// Lock acquires exclusive use of the device so that multi-step sequences, such as
+// a read-modify-write or a command followed by a read, are not interleaved with
+// other goroutines using the same device. The lock is shared by all handles to the
+// same address on a Bus.
+func (i2c *I2C) Lock() {
+	i2c = i2c.device()
+	if l, ok := i2c.Conn.(sync.Locker); ok {
+		l.Lock()
+	} else {
+		i2c.mu.Lock()
+	}
 }
 
-type i2c_rdwr_ioctl_data struct {
-	msgs uintptr
-	nmsg uint32
+// TryLock tries to acquire exclusive use of the device without waiting, and
+// reports whether it succeeded. It waits if the connection is a sync.Locker
+// that cannot try.
+func (i2c *I2C) TryLock() bool {
+	i2c = i2c.device()
+	if l, ok := i2c.Conn.(interface{ TryLock() bool }); ok {
+		return l.TryLock()
+	}
+
+	if l, ok := i2c.Conn.(sync.Locker); ok {
+		l.Lock()
+		return true
+	}
+
+	return i2c.mu.TryLock()
+}
+
+// Unlock releases the exclusive use of the device
+func (i2c *I2C) Unlock() {
+	i2c = i2c.device()
+	if l, ok := i2c.Conn.(sync.Locker); ok {
+		l.Unlock()
+	} else {
+		i2c.mu.Unlock()
+	}
+}
+
+// ReadReg reads from a register with an 8-bit address with the retry policy and tracer
+func (i2c *I2C) ReadReg(reg byte, length int) (val []byte, err error) {
+	return i2c.transact(OpRead, int(reg), nil, func() ([]byte, error) { return i2c.Conn.ReadReg(reg, length) })
+}
+
+// ReadReg16 reads from a register with a 16-bit address with the retry policy and tracer
+func (i2c *I2C) ReadReg16(reg uint16, length int) (val []byte, err error) {
+	return i2c.transact(OpRead, int(reg), nil, func() ([]byte, error) { return i2c.Conn.ReadReg16(reg, length) })
+}
+
+// ReadRegInto fills buf from a register with an 8-bit address with the retry
+// policy and tracer, without allocating if the connection is an IntoReader
+func (i2c *I2C) ReadRegInto(reg byte, buf []byte) (err error) {
+	_, err = i2c.transact(OpRead, int(reg), nil, func() ([]byte, error) {
+		if r, ok := i2c.Conn.(IntoReader); ok {
+			return buf, r.ReadRegInto(reg, buf)
+		}
+
+		val, err := i2c.Conn.ReadReg(reg, len(buf))
+		copy(buf, val)
+		return buf, err
+	})
+
+	return
+}
+
+// ReadReg16Into fills buf from a register with a 16-bit address with the retry
+// policy and tracer, without allocating if the connection is an IntoReader
+func (i2c *I2C) ReadReg16Into(reg uint16, buf []byte) (err error) {
+	_, err = i2c.transact(OpRead, int(reg), nil, func() ([]byte, error) {
+		if r, ok := i2c.Conn.(IntoReader); ok {
+			return buf, r.ReadReg16Into(reg, buf)
+		}
+
+		val, err := i2c.Conn.ReadReg16(reg, len(buf))
+		copy(buf, val)
+		return buf, err
+	})
+
+	return
+}
+
+// Write writes raw bytes with the retry policy and tracer
+func (i2c *I2C) Write(val []byte) (err error) {
+	_, err = i2c.transact(OpWrite, -1, val, func() ([]byte, error) { return nil, i2c.Conn.Write(val) })
+	return
+}
+
+// WriteReg writes to a register with an 8-bit address with the retry policy and tracer
+func (i2c *I2C) WriteReg(reg byte, val []byte) (err error) {
+	_, err = i2c.transact(OpWrite, int(reg), val, func() ([]byte, error) { return nil, i2c.Conn.WriteReg(reg, val) })
+	return
 }
 
-// OpenI2C opens an I2C device at a particular address on a bus
+// WriteReg16 writes to a register with a 16-bit address with the retry policy and tracer
+func (i2c *I2C) WriteReg16(reg uint16, val []byte) (err error) {
+	_, err = i2c.transact(OpWrite, int(reg), val, func() ([]byte, error) { return nil, i2c.Conn.WriteReg16(reg, val) })
+	return
+}
+
+// Transfer submits the messages to the device as one combined transaction with a
+// repeated start between each message, for sequences that are not a register
+// read or write, such as a read without a register address or a write-write-read.
+// The data of the read messages is filled in. Fails with ErrNotSupported if the
+// connection is not a Transferer.
+func (i2c *I2C) Transfer(msgs ...Msg) (err error) {
+	t, ok := i2c.Conn.(Transferer)
+	if !ok {
+		return ErrNotSupported
+	}
+
+	traced := i2c.Tracer() != nil
+	_, err = i2c.transact(OpTransfer, -1, nil, func() (data []byte, err error) {
+		if err = t.Transfer(msgs...); err != nil || !traced {
+			return
+		}
+
+		for _, m := range msgs {
+			data = append(data, m.Data...)
+		}
+
+		return
+	})
+
+	return
+}
+
+// transact makes a transaction with the connection, retrying it with the retry
+// policy if it is a read or the policy retries writes, and reporting each attempt
+// to the tracer
+func (i2c *I2C) transact(op string, reg int, write []byte, fn func() ([]byte, error)) (read []byte, err error) {
+	tracer, clock := i2c.Tracer(), i2c.Clock()
+	retry := false
+
+	err = i2c.withRetry(op != OpRead && op != OpSMBusRead, func() (err error) {
+		if tracer == nil {
+			read, err = fn()
+			return
+		}
+
+		start := clock.Now()
+		read, err = fn()
+
+		data := write
+		if read != nil {
+			data = read
+		}
+
+		i2c.trace(tracer, op, reg, data, clock.Now().Sub(start), retry, err)
+		retry = true
+		return
+	})
+
+	return
+}
+
+// Address returns the address of the device, or 0 if the connection does not have an address
+func (i2c *I2C) Address() uint16 {
+	if a, ok := i2c.Conn.(interface{ Address() uint16 }); ok {
+		return a.Address()
+	}
+
+	return 0
+}
+
+// TenBit reports whether the address of the device is a 10-bit address
+func (i2c *I2C) TenBit() bool {
+	if a, ok := i2c.Conn.(interface{ TenBit() bool }); ok {
+		return a.TenBit()
+	}
+
+	return false
+}
+
+// devConn is a Conn to a device at an address on a Bus. The messages and
+// buffers for the register address and writes are reused by every transaction.
+type devConn struct {
+	bus *Bus
+	slaveAddr
+	ownsBus bool
+	pec     bool
+	bufMu   sync.Mutex
+	reg     [2]byte
+	msgs    [2]i2c_msg
+	wbuf    []byte
+}
+
+// OpenI2C opens an I2C device at a particular address on a bus. The device has
+// its own handle to the bus which is closed with the device. Use OpenBus to
+// share a single handle between multiple devices. If a kernel driver is bound to
+// the address it fails with a *KernelDriverError naming the driver.
 func OpenI2C(address uint8, bus int) (i2c *I2C, err error) {
-	i2c = &I2C{address: address}
+	return openI2C(slaveAddr{address: uint16(address)}, bus)
+}
+
+// OpenI2C10 opens an I2C device at a 10-bit address (0x000 to 0x3FF) on a bus
+// like OpenI2C. The adapter must support Func10BitAddr.
+func OpenI2C10(address uint16, bus int) (i2c *I2C, err error) {
+	return openI2C(slaveAddr{address: address, tenBit: true}, bus)
+}
 
-	if i2c.dev, err = os.OpenFile(fmt.Sprintf("/dev/i2c-%d", bus), os.O_RDWR, 0600); err != nil {
+// OpenI2CForce opens an I2C device like OpenI2C but with I2C_SLAVE_FORCE, so
+// that it succeeds even if a kernel driver is bound to the address. Only use it
+// if the kernel driver will not be disturbed, as the device is then accessed by both.
+func OpenI2CForce(address uint8, bus int) (i2c *I2C, err error) {
+	return openI2C(slaveAddr{address: uint16(address), force: true}, bus)
+}
+
+func openI2C(a slaveAddr, bus int) (i2c *I2C, err error) {
+	var b *Bus
+	if b, err = OpenBus(bus); err != nil {
 		return
 	}
 
-	var errno syscall.Errno
-	if _, _, errno = syscall.Syscall(syscall.SYS_IOCTL, i2c.dev.Fd(), I2C_SLAVE, uintptr(address)); errno != 0 {
-		err = fmt.Errorf("failed to set the I2C address on bus %d: %s", bus, errno.Error())
+	errno := syscall.EOPNOTSUPP
+	if !a.tenBit || b.funcs.Has(Func10BitAddr) {
+		b.mu.Lock()
+		errno = b.setSlave(a)
+		b.mu.Unlock()
+	}
+
+	if errno != 0 {
+		b.Close()
+		err = &I2CError{Op: "set address", Bus: bus, Address: a.address, TenBit: a.tenBit, Reg: -1, Errno: errno}
+
+		if errno == syscall.EBUSY {
+			if driver, _ := kernelDriver(bus, a); driver != "" {
+				err = &KernelDriverError{Bus: bus, Address: a.address, TenBit: a.tenBit, Driver: driver, Err: err}
+			}
+		}
+
 		return
 	}
 
+	i2c = NewI2C(&devConn{bus: b, slaveAddr: a, ownsBus: true})
 	return
 }
 
-func uintptrToByteSliceData(s []byte) uintptr {
-	return uintptr(unsafe.Pointer((*reflect.SliceHeader)(unsafe.Pointer(&s)).Data))
+// Address returns the address of the device on the bus
+func (d *devConn) Address() uint16 {
+	return d.address
 }
 
-// readReg uses the RDWR ioctl call to read from an I2C register
-func (i2c *I2C) ReadReg(reg byte, length int) (val []byte, err error) {
+// TenBit reports whether the address of the device is a 10-bit address
+func (d *devConn) TenBit() bool {
+	return d.tenBit
+}
+
+// error creates the error for a failed transaction with the device
+func (d *devConn) error(op string, reg int, errno syscall.Errno) error {
+	return &I2CError{Op: op, Bus: d.bus.bus, Address: d.address, TenBit: d.tenBit, Reg: reg, Errno: errno}
+}
+
+// checkLength fails with an error matching ErrInvalidLength and EINVAL if a
+// message of n bytes is too long for an i2c_msg, rather than truncating it
+func (d *devConn) checkLength(op string, reg int, n int) (err error) {
+	if n > maxMsgLen {
+		err = fmt.Errorf("%w (%d bytes): %w", ErrInvalidLength, n, d.error(op, reg, syscall.EINVAL))
+	}
+
+	return
+}
+
+// ReadReg uses the RDWR ioctl call to read from an I2C register
+func (d *devConn) ReadReg(reg byte, length int) (val []byte, err error) {
 	val = make([]byte, length)
+	err = d.ReadRegInto(reg, val)
+	return
+}
+
+// ReadReg16 uses the RDWR ioctl call to read from an I2C register with a 16-bit address
+func (d *devConn) ReadReg16(reg uint16, length int) (val []byte, err error) {
+	val = make([]byte, length)
+	err = d.ReadReg16Into(reg, val)
+	return
+}
+
+// ReadRegInto uses the RDWR ioctl call to read from an I2C register into buf
+func (d *devConn) ReadRegInto(reg byte, buf []byte) (err error) {
+	if err = d.checkLength(OpRead, int(reg), len(buf)); err != nil {
+		return
+	}
+
+	d.bufMu.Lock()
+	defer d.bufMu.Unlock()
 
-	messages := [2]i2c_msg{
-		{
-			addr:  uint16(i2c.address),
-			flags: 0,
-			len:   1,
-			buf:   uintptr(unsafe.Pointer(&reg)),
-		},
-		{
-			addr:  uint16(i2c.address),
-			flags: 1,
-			len:   uint16(length),
-			buf:   uintptrToByteSliceData(val),
-		},
+	d.reg[0] = reg
+	if errno := d.readInto(d.reg[:1], buf); errno != 0 {
+		err = d.error(OpRead, int(reg), errno)
 	}
 
-	request := i2c_rdwr_ioctl_data{
-		msgs: uintptr(unsafe.Pointer(&messages)),
-		nmsg: 2,
+	return
+}
+
+// ReadReg16Into uses the RDWR ioctl call to read from an I2C register with a 16-bit address into buf
+func (d *devConn) ReadReg16Into(reg uint16, buf []byte) (err error) {
+	if err = d.checkLength(OpRead, int(reg), len(buf)); err != nil {
+		return
+	}
+
+	d.bufMu.Lock()
+	defer d.bufMu.Unlock()
+
+	d.reg[0], d.reg[1] = byte((reg>>8)&0xFF), byte(reg&0xFF)
+	if errno := d.readInto(d.reg[:2], buf); errno != 0 {
+		err = d.error(OpRead, int(reg), errno)
+	}
+
+	return
+}
+
+// readInto writes the register address and reads into buf with the reused
+// messages, must be called with the buffer lock held
+func (d *devConn) readInto(reg []byte, buf []byte) (errno syscall.Errno) {
+	d.msgs[0] = newMsg(d.address, d.msgFlags(), reg)
+	d.msgs[1] = newMsg(d.address, d.msgFlags()|I2C_M_RD, buf)
+
+	errno = d.bus.rdwr(d.msgs[:])
+	d.msgs = [2]i2c_msg{} // do not keep the buffer of the caller reachable
+	return
+}
+
+// Transfer uses the RDWR ioctl call to submit the messages in a single transaction
+func (d *devConn) Transfer(msgs ...Msg) (err error) {
+	if len(msgs) == 0 {
+		return
+	}
+
+	messages := make([]i2c_msg, len(msgs))
+	for i, m := range msgs {
+		if err = d.checkLength(OpTransfer, -1, len(m.Data)); err != nil {
+			return
+		}
+
+		flags := d.msgFlags()
+		if m.Read {
+			flags |= I2C_M_RD
+		}
+
+		messages[i] = newMsg(d.address, flags, m.Data)
 	}
 
-	var errno syscall.Errno
-	if _, _, errno = syscall.Syscall(syscall.SYS_IOCTL, i2c.dev.Fd(), I2C_RDWR, uintptr(unsafe.Pointer(&request))); errno != 0 {
-		err = fmt.Errorf("failed to read from I2C register 0x%X at address 0x%X: %s", reg, i2c.address, errno.Error())
+	if errno := d.bus.rdwr(messages); errno != 0 {
+		err = d.error(OpTransfer, -1, errno)
 	}
 
 	return
 }
 
+// i2c_ioctl_rdwr_write makes a call to the ioctl RDWR with a write package of the
+// prefix followed by the data, must be called with the buffer lock held
+func (d *devConn) i2c_ioctl_rdwr_write(prefix []byte, val []byte) (errno syscall.Errno) {
+	d.wbuf = append(append(d.wbuf[:0], prefix...), val...)
+
+	d.msgs[0] = newMsg(d.address, d.msgFlags(), d.wbuf)
+
+	errno = d.bus.rdwr(d.msgs[:1])
+	d.msgs[0] = i2c_msg{}
+	return
+}
+
+// Write uses the RDWR ioctl call to write
+func (d *devConn) Write(val []byte) (err error) {
+	if err = d.checkLength(OpWrite, -1, len(val)); err != nil {
+		return
+	}
+
+	d.bufMu.Lock()
+	defer d.bufMu.Unlock()
+
+	if errno := d.i2c_ioctl_rdwr_write(nil, val); errno != 0 {
+		err = d.error(OpWrite, -1, errno)
+	}
+
+	return
+}
+
+// WriteReg uses the RDWR ioctl call to write to an I2C register
+func (d *devConn) WriteReg(reg byte, val []byte) (err error) {
+	if err = d.checkLength(OpWrite, int(reg), 1+len(val)); err != nil {
+		return
+	}
+
+	d.bufMu.Lock()
+	defer d.bufMu.Unlock()
+
+	d.reg[0] = reg
+	if errno := d.i2c_ioctl_rdwr_write(d.reg[:1], val); errno != 0 {
+		err = d.error(OpWrite, int(reg), errno)
+	}
+
+	return
+}
+
+// WriteReg16 uses the RDWR ioctl call to write to an I2C register with a 16-bit address
+func (d *devConn) WriteReg16(reg uint16, val []byte) (err error) {
+	if err = d.checkLength(OpWrite, int(reg), 2+len(val)); err != nil {
+		return
+	}
+
+	d.bufMu.Lock()
+	defer d.bufMu.Unlock()
+
+	d.reg[0], d.reg[1] = byte((reg>>8)&0xFF), byte(reg&0xFF)
+	if errno := d.i2c_ioctl_rdwr_write(d.reg[:2], val); errno != 0 {
+		err = d.error(OpWrite, int(reg), errno)
+	}
+
+	return
+}
+
+// Lock acquires exclusive use of the address on the bus for a multi-step sequence
+func (d *devConn) Lock() {
+	d.bus.addressLock(d.slaveAddr).Lock()
+}
+
+// TryLock acquires the address on the bus if it is not in use
+func (d *devConn) TryLock() bool {
+	return d.bus.addressLock(d.slaveAddr).TryLock()
+}
+
+// Unlock releases the exclusive use of the address on the bus
+func (d *devConn) Unlock() {
+	d.bus.addressLock(d.slaveAddr).Unlock()
+}
+
+// Close an I2C device, closing the bus if it was opened with the device
+func (d *devConn) Close() {
+	if d.ownsBus {
+		d.bus.Close()
+	}
+}
+
 // ReadRegU8 reads an unsigned 8-bit value a register
 func (i2c *I2C) ReadRegU8(reg byte) (val byte, err error) {
-	var buf []byte
-	if buf, err = i2c.ReadReg(reg, 1); err != nil {
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
+
+	if err = i2c.ReadRegInto(reg, i2c.buf[:1]); err != nil {
 		return
 	}
 
-	val = buf[0]
+	val = i2c.buf[0]
 	return
 }
 
 // ReadRegU16BE reads an unsigned 16-bit value in big endian format from a register
 func (i2c *I2C) ReadRegU16BE(reg byte) (val uint16, err error) {
-	var buf []byte
-	if buf, err = i2c.ReadReg(reg, 2); err != nil {
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
+
+	if err = i2c.ReadRegInto(reg, i2c.buf[:2]); err != nil {
 		return
 	}
 
-	val = binary.BigEndian.Uint16(buf)
+	val = binary.BigEndian.Uint16(i2c.buf[:2])
 	return
 }
 
 // ReadRegS16BE reads a signed 16-bit value in big endian format from a register
 func (i2c *I2C) ReadRegS16BE(reg byte) (val int16, err error) {
-	var buf []byte
-	if buf, err = i2c.ReadReg(reg, 2); err != nil {
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
+
+	if err = i2c.ReadRegInto(reg, i2c.buf[:2]); err != nil {
 		return
 	}
 
-	val = int16(binary.BigEndian.Uint16(buf))
+	val = int16(binary.BigEndian.Uint16(i2c.buf[:2]))
 	return
 }
 
 // ReadRegU16LE reads an unsigned 16-bit value in little endian format from a register
 func (i2c *I2C) ReadRegU16LE(reg byte) (val uint16, err error) {
-	var buf []byte
-	if buf, err = i2c.ReadReg(reg, 2); err != nil {
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
+
+	if err = i2c.ReadRegInto(reg, i2c.buf[:2]); err != nil {
 		return
 	}
 
-	val = binary.LittleEndian.Uint16(buf)
+	val = binary.LittleEndian.Uint16(i2c.buf[:2])
 	return
 }
 
 // ReadRegU24BE reads an unsigned 24-bit value in big endian format from a register
 func (i2c *I2C) ReadRegU24BE(reg byte) (val uint32, err error) {
-	var buf []byte
-	if buf, err = i2c.ReadReg(reg, 3); err != nil {
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
+
+	if err = i2c.ReadRegInto(reg, i2c.buf[:3]); err != nil {
 		return
 	}
 
-	val = uint32(buf[0])<<16 + uint32(buf[1])<<8 + uint32(buf[2])
+	val = uint32(i2c.buf[0])<<16 + uint32(i2c.buf[1])<<8 + uint32(i2c.buf[2])
 	return
 }
 
 // ReadRegU32LE reads an unsigned 32-bit value in little endian format from a register
 func (i2c *I2C) ReadRegU32LE(reg byte) (val uint32, err error) {
-	var buf []byte
-	if buf, err = i2c.ReadReg(reg, 4); err != nil {
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
+
+	if err = i2c.ReadRegInto(reg, i2c.buf[:4]); err != nil {
 		return
 	}
 
-	val = binary.LittleEndian.Uint32(buf)
+	val = binary.LittleEndian.Uint32(i2c.buf[:4])
 	return
 }
 
@@ -179,165 +653,120 @@ func (i2c *I2C) ReadRegBits(reg byte, bitPos uint, numBits uint) (val int, err e
 	return
 }
 
-// ReadReg16 uses the RDWR ioctl call to read from an I2C register with a 16-bit address
-func (i2c *I2C) ReadReg16(reg uint16, length int) (val []byte, err error) {
-
-	val = make([]byte, length)
-
-	messages := [2]i2c_msg{
-		{
-			addr:  uint16(i2c.address),
-			flags: 0,
-			len:   2,
-			buf:   uintptr(unsafe.Pointer(&([2]byte{byte((reg >> 8) & 0xFF), byte(reg & 0xFF)}))),
-		},
-		{
-			addr:  uint16(i2c.address),
-			flags: 1,
-			len:   uint16(length),
-			buf:   uintptrToByteSliceData(val),
-		},
-	}
-
-	request := i2c_rdwr_ioctl_data{
-		msgs: uintptr(unsafe.Pointer(&messages)),
-		nmsg: 2,
-	}
-
-	var errno syscall.Errno
-	if _, _, errno = syscall.Syscall(syscall.SYS_IOCTL, i2c.dev.Fd(), I2C_RDWR, uintptr(unsafe.Pointer(&request))); errno != 0 {
-		err = fmt.Errorf("failed to read from I2C register 0x%X at address 0x%X: %s", reg, i2c.address, errno.Error())
-	}
-
-	return
-}
-
 // ReadReg16U8 reads an unsigned 8-bit value a register
 func (i2c *I2C) ReadReg16U8(reg uint16) (val byte, err error) {
-	var buf []byte
-	if buf, err = i2c.ReadReg16(reg, 1); err != nil {
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
+
+	if err = i2c.ReadReg16Into(reg, i2c.buf[:1]); err != nil {
 		return
 	}
 
-	val = buf[0]
+	val = i2c.buf[0]
 	return
 }
 
 // ReadReg16U16BE reads an unsigned 16-bit value in big endian format from a register with a 16-bit address
 func (i2c *I2C) ReadReg16U16BE(reg uint16) (val uint16, err error) {
-	var buf []byte
-	if buf, err = i2c.ReadReg16(reg, 2); err != nil {
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
+
+	if err = i2c.ReadReg16Into(reg, i2c.buf[:2]); err != nil {
 		return
 	}
 
-	val = binary.BigEndian.Uint16(buf)
+	val = binary.BigEndian.Uint16(i2c.buf[:2])
 	return
 }
 
 // ReadReg16U16LE reads an unsigned 16-bit value in little endian format from a register with a 16-bit address
 func (i2c *I2C) ReadReg16U16LE(reg uint16) (val uint16, err error) {
-	var buf []byte
-	if buf, err = i2c.ReadReg16(reg, 2); err != nil {
-		return
-	}
-
-	val = binary.LittleEndian.Uint16(buf)
-	return
-}
-
-// i2c_ioctl_rdwr_write makes a call to the ioctl RDWR with a write package and the passed data
-func (i2c *I2C) i2c_ioctl_rdwr_write(val []byte) (errno syscall.Errno) {
-	message := i2c_msg{
-		addr:  uint16(i2c.address),
-		flags: 0,
-		len:   uint16(len(val)),
-		buf:   uintptrToByteSliceData(val),
-	}
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
 
-	request := i2c_rdwr_ioctl_data{
-		msgs: uintptr(unsafe.Pointer(&message)),
-		nmsg: 1,
-	}
-
-	_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, i2c.dev.Fd(), I2C_RDWR, uintptr(unsafe.Pointer(&request)))
-	return
-}
-
-// Write uses the RDWR ioctl call to write
-func (i2c *I2C) Write(val []byte) (err error) {
-	if errno := i2c.i2c_ioctl_rdwr_write(val); errno != 0 {
-		err = fmt.Errorf("failed to write to I2C at address 0x%X: %s", i2c.address, errno.Error())
+	if err = i2c.ReadReg16Into(reg, i2c.buf[:2]); err != nil {
+		return
 	}
 
+	val = binary.LittleEndian.Uint16(i2c.buf[:2])
 	return
 }
 
 // WriteU8 uses the RDWR ioctl call to write a byte
 func (i2c *I2C) WriteU8(val byte) (err error) {
-	err = i2c.Write([]byte{val})
-	return
-}
-
-// WriteReg uses the RDWR ioctl call to write to an I2C register
-func (i2c *I2C) WriteReg(reg byte, val []byte) (err error) {
-	msgbuf := append([]byte{reg}, val...)
-
-	if errno := i2c.i2c_ioctl_rdwr_write(msgbuf); errno != 0 {
-		err = fmt.Errorf("failed to write to I2C register 0x%X at address 0x%X: %s", reg, i2c.address, errno.Error())
-	}
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
 
+	i2c.buf[0] = val
+	err = i2c.Write(i2c.buf[:1])
 	return
 }
 
 // WriteRegU8 writes an unsigned 8-bit value to an I2C register
 func (i2c *I2C) WriteRegU8(reg byte, val byte) (err error) {
-	err = i2c.WriteReg(reg, []byte{val})
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
+
+	i2c.buf[0] = val
+	err = i2c.WriteReg(reg, i2c.buf[:1])
 	return
 }
 
 // WriteRegU16BE writes an unsigned 16-bit big endian value to an I2C register with a 16-bit address
 func (i2c *I2C) WriteRegU16BE(reg byte, val uint16) (err error) {
-	err = i2c.WriteReg(reg, []byte{byte((val >> 8) & 0xFF), byte(val & 0xFF)})
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
+
+	binary.BigEndian.PutUint16(i2c.buf[:2], val)
+	err = i2c.WriteReg(reg, i2c.buf[:2])
 	return
 }
 
 // WriteRegU16LE writes an unsigned 16-bit little endian value to an I2C register with a 16-bit address
 func (i2c *I2C) WriteRegU16LE(reg byte, val uint16) (err error) {
-	err = i2c.WriteReg(reg, []byte{byte(val & 0xFF), byte((val >> 8) & 0xFF)})
-	return
-}
-
-// WriteReg16 uses the RDWR ioctl call to write to an I2C register with a 16-bit address
-func (i2c *I2C) WriteReg16(reg uint16, val []byte) (err error) {
-	msgbuf := append([]byte{byte((reg >> 8) & 0xFF), byte(reg & 0xFF)}, val...)
-
-	if errno := i2c.i2c_ioctl_rdwr_write(msgbuf); errno != 0 {
-		err = fmt.Errorf("failed to write to I2C register 0x%X at address 0x%X: %s", reg, i2c.address, errno.Error())
-	}
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
 
+	binary.LittleEndian.PutUint16(i2c.buf[:2], val)
+	err = i2c.WriteReg(reg, i2c.buf[:2])
 	return
 }
 
 // WriteReg16U8 writes an unsigned 8-bit value to an I2C register with a 16-bit address
 func (i2c *I2C) WriteReg16U8(reg uint16, val byte) (err error) {
-	err = i2c.WriteReg16(reg, []byte{val})
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
+
+	i2c.buf[0] = val
+	err = i2c.WriteReg16(reg, i2c.buf[:1])
 	return
 }
 
 // WriteReg16U16BE writes an unsigned 16-bit big endian value to an I2C register with a 16-bit address
 func (i2c *I2C) WriteReg16U16BE(reg uint16, val uint16) (err error) {
-	err = i2c.WriteReg16(reg, []byte{byte((val >> 8) & 0xFF), byte(val & 0xFF)})
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
+
+	binary.BigEndian.PutUint16(i2c.buf[:2], val)
+	err = i2c.WriteReg16(reg, i2c.buf[:2])
 	return
 }
 
 // WriteReg16U16LE writes an unsigned 16-bit little endian value to an I2C register with a 16-bit address
 func (i2c *I2C) WriteReg16U16LE(reg uint16, val uint16) (err error) {
-	err = i2c.WriteReg16(reg, []byte{byte(val & 0xFF), byte((val >> 8) & 0xFF)})
+	i2c.bufMu.Lock()
+	defer i2c.bufMu.Unlock()
+
+	binary.LittleEndian.PutUint16(i2c.buf[:2], val)
+	err = i2c.WriteReg16(reg, i2c.buf[:2])
 	return
 }
 
 // WriteRegBit reads the existing registry value and updates the bitPos with val
 func (i2c *I2C) WriteRegBit(reg byte, bitPos uint, val bool) (err error) {
+	i2c.Lock()
+	defer i2c.Unlock()
+
 	var buf byte
 	if buf, err = i2c.ReadRegU8(reg); err != nil {
 		return
@@ -355,6 +784,9 @@ func (i2c *I2C) WriteRegBit(reg byte, bitPos uint, val bool) (err error) {
 
 // WriteRegBits reads the existing registry value and updates the numBits at bitPos with val
 func (i2c *I2C) WriteRegBits(reg byte, bitPos uint, numBits uint, val int) (err error) {
+	i2c.Lock()
+	defer i2c.Unlock()
+
 	var buf byte
 	if buf, err = i2c.ReadRegU8(reg); err != nil {
 		return
@@ -366,8 +798,3 @@ func (i2c *I2C) WriteRegBits(reg byte, bitPos uint, numBits uint, val int) (err
 	err = i2c.WriteRegU8(reg, buf)
 	return
 }
-
-// Close an I2C device
-func (i2c *I2C) Close() {
-	i2c.dev.Close()
-}
@@ -0,0 +1,176 @@
+package piicodev
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestI2CWriteRegBitConcurrent(t *testing.T) {
+	f := NewFakeConn()
+	i2c := NewI2C(f)
+
+	var wg sync.WaitGroup
+	for bit := uint(0); bit < 8; bit++ {
+		wg.Add(1)
+		go func(bit uint) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if err := i2c.WriteRegBit(0x01, bit, i%2 == 0); err != nil {
+					t.Errorf("Error writing bit %d: %v", bit, err)
+					return
+				}
+			}
+		}(bit)
+	}
+	wg.Wait()
+
+	if v := f.Reg(0x01, 1)[0]; v != 0x00 {
+		t.Errorf("Register is 0x%X rather than 0x00 after concurrent read-modify-writes", v)
+	}
+}
+
+func TestI2CTransfer(t *testing.T) {
+	f := NewFakeConn()
+	i2c := NewI2C(f)
+
+	if err := i2c.Transfer(Msg{Data: []byte{0x10, 0xAA, 0xBB, 0xCC}}); err != nil {
+		t.Fatalf("Error writing with a transfer: %v", err)
+	}
+
+	first := make([]byte, 2)
+	rest := make([]byte, 1)
+	if err := i2c.Transfer(Msg{Data: []byte{0x00}}, Msg{Data: []byte{0x10}}, Msg{Read: true, Data: first}, Msg{Read: true, Data: rest}); err != nil {
+		t.Fatalf("Error reading with a transfer: %v", err)
+	}
+
+	if !bytes.Equal(first, []byte{0xAA, 0xBB}) || !bytes.Equal(rest, []byte{0xCC}) {
+		t.Errorf("Transfer read %X %X rather than AABB CC", first, rest)
+	}
+
+	expected := []FakeTx{
+		{Write: []byte{0x10, 0xAA, 0xBB, 0xCC}},
+		{Write: []byte{0x00}},
+		{Write: []byte{0x10}, Read: []byte{0xAA, 0xBB, 0xCC}},
+	}
+
+	log := f.Log()
+	if len(log) != len(expected) {
+		t.Fatalf("Transfers logged %d transactions rather than %d", len(log), len(expected))
+	}
+
+	for i := range expected {
+		if !bytes.Equal(log[i].Write, expected[i].Write) || !bytes.Equal(log[i].Read, expected[i].Read) {
+			t.Errorf("Transaction %d was %X/%X rather than %X/%X", i, log[i].Write, log[i].Read, expected[i].Write, expected[i].Read)
+		}
+	}
+
+	f.QueueReadReg(0x20, []byte{0x01})
+	short := []byte{0xFF, 0xFF}
+	if err := i2c.Transfer(Msg{Data: []byte{0x20}}, Msg{Read: true, Data: short}); err != nil || !bytes.Equal(short, []byte{0x01, 0x00}) {
+		t.Errorf("Transfer of a short queued response read %X (%v) rather than 0100", short, err)
+	}
+
+	if err := NewI2C(struct{ Conn }{f}).Transfer(Msg{Read: true, Data: rest}); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Transfer on a connection without transfers returned %v", err)
+	}
+}
+
+// nopConn is a connection that does nothing, for measuring the allocations of the I2C layer
+type nopConn struct{}
+
+func (nopConn) ReadReg(reg byte, length int) (val []byte, err error) {
+	return make([]byte, length), nil
+}
+func (nopConn) ReadReg16(reg uint16, length int) (val []byte, err error) {
+	return make([]byte, length), nil
+}
+func (nopConn) ReadRegInto(reg byte, buf []byte) (err error)     { return }
+func (nopConn) ReadReg16Into(reg uint16, buf []byte) (err error) { return }
+func (nopConn) Write(val []byte) (err error)                     { return }
+func (nopConn) WriteReg(reg byte, val []byte) (err error)        { return }
+func (nopConn) WriteReg16(reg uint16, val []byte) (err error)    { return }
+func (nopConn) Transfer(msgs ...Msg) (err error)                 { return }
+func (nopConn) Close()                                           {}
+
+func TestI2CHelpersDoNotAllocate(t *testing.T) {
+	i2c := NewI2C(nopConn{})
+	buf := make([]byte, 17)
+	msgs := []Msg{{Data: buf[:1]}, {Read: true, Data: buf[1:]}}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		i2c.ReadRegU8(0x01)
+		i2c.ReadRegS16BE(0x01)
+		i2c.ReadRegU24BE(0x01)
+		i2c.ReadRegU32LE(0x01)
+		i2c.ReadReg16U16BE(0x0001)
+		i2c.ReadRegInto(0x01, buf)
+		i2c.ReadReg16Into(0x0001, buf)
+		i2c.WriteRegU8(0x01, 0x02)
+		i2c.WriteRegU16BE(0x01, 0x0203)
+		i2c.WriteReg16U16LE(0x0001, 0x0203)
+		i2c.WriteRegBit(0x01, 3, true)
+		i2c.Transfer(msgs...)
+	})
+
+	if allocs != 0 {
+		t.Errorf("Typed helpers made %.1f allocations rather than none", allocs)
+	}
+}
+
+// TestBusDeviceDoesNotAllocate measures the allocations of the typed helpers of a
+// device opened on a bus, down to the I2C_RDWR ioctl call
+func TestBusDeviceDoesNotAllocate(t *testing.T) {
+	rdwrHook = func(i2c_rdwr_ioctl_data) syscall.Errno { return 0 }
+	defer func() { rdwrHook = nil }()
+
+	b := &Bus{bus: 1, locks: make(map[uint16]*sync.Mutex), slave: -1, funcs: ^Functionality(0)}
+	i2c := b.Open(0x29)
+	buf := make([]byte, 17)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		i2c.ReadRegU8(0x01)
+		i2c.ReadRegS16BE(0x01)
+		i2c.ReadReg16U16BE(0x0001)
+		i2c.ReadRegInto(0x01, buf)
+		i2c.ReadReg16Into(0x0001, buf)
+		i2c.WriteRegU8(0x01, 0x02)
+		i2c.WriteReg16U16LE(0x0001, 0x0203)
+	})
+
+	if allocs != 0 {
+		t.Errorf("Device on a bus made %.1f allocations rather than none", allocs)
+	}
+}
+
+func TestI2CReadRegInto(t *testing.T) {
+	f := NewFakeConn()
+	f.SetReg(0x10, 0x01, 0x02, 0x03)
+
+	buf := make([]byte, 3)
+	for _, conn := range []Conn{f, struct{ Conn }{f}} {
+		if err := NewI2C(conn).ReadRegInto(0x10, buf); err != nil || !bytes.Equal(buf, []byte{0x01, 0x02, 0x03}) {
+			t.Errorf("ReadRegInto read %X (%v) rather than 010203", buf, err)
+		}
+	}
+}
+
+func TestI2CMessageLength(t *testing.T) {
+	d := &devConn{bus: &Bus{bus: 1, locks: make(map[uint16]*sync.Mutex), slave: -1}, slaveAddr: slaveAddr{address: 0x10}}
+	long := make([]byte, maxMsgLen+1)
+
+	for _, err := range []error{
+		d.ReadRegInto(0x10, long),
+		d.Write(long),
+		d.WriteReg(0x10, long[1:]),
+		d.WriteReg16(0x0010, long[2:]),
+		d.Transfer(Msg{Read: true, Data: long}),
+	} {
+		var e *I2CError
+		if !errors.Is(err, ErrInvalidLength) || !errors.Is(err, syscall.EINVAL) || !errors.As(err, &e) || e.Address != 0x10 {
+			t.Errorf("Message longer than %d bytes returned %v", maxMsgLen, err)
+		}
+	}
+}
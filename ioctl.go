@@ -0,0 +1,106 @@
+// Marshalling of the Linux i2c-dev ioctl calls
+package piicodev
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	I2C_SLAVE       uintptr = 0x0703
+	I2C_SLAVE_FORCE uintptr = 0x0706
+	I2C_TENBIT      uintptr = 0x0704
+	I2C_PEC         uintptr = 0x0708
+	I2C_RDWR        uintptr = 0x0707
+	I2C_SMBUS       uintptr = 0x0720
+)
+
+const (
+	// I2C_M_RD is the flag of an i2c_msg that reads from the device
+	I2C_M_RD uint16 = 0x0001
+
+	// I2C_M_TEN is the flag of an i2c_msg to a device with a 10-bit address
+	I2C_M_TEN uint16 = 0x0010
+
+	// maxMsgLen is the most bytes in an i2c_msg, as its length is 16 bits
+	maxMsgLen = 0xFFFF
+)
+
+// i2c_msg is struct i2c_msg from linux/i2c.h. The buffer is held as a pointer
+// rather than a uintptr so that the garbage collector keeps it alive and does
+// not move it while the message refers to it.
+type i2c_msg struct {
+	addr  uint16
+	flags uint16
+	len   uint16
+	buf   *byte
+}
+
+// i2c_rdwr_ioctl_data is struct i2c_rdwr_ioctl_data from linux/i2c-dev.h
+type i2c_rdwr_ioctl_data struct {
+	msgs *i2c_msg
+	nmsg uint32
+}
+
+const (
+	// I2C_SMBUS_READ and I2C_SMBUS_WRITE are the directions of an SMBus transaction
+	I2C_SMBUS_READ  uint8 = 1
+	I2C_SMBUS_WRITE uint8 = 0
+
+	// I2C_SMBUS_BLOCK_MAX is the most data bytes in an SMBus block transfer
+	I2C_SMBUS_BLOCK_MAX = 32
+)
+
+// i2c_smbus_data is union i2c_smbus_data from linux/i2c.h, with the byte and
+// word in the first bytes of the block and the length of a block in the first byte
+type i2c_smbus_data [I2C_SMBUS_BLOCK_MAX + 2]byte
+
+// i2c_smbus_ioctl_data is struct i2c_smbus_ioctl_data from linux/i2c-dev.h
+type i2c_smbus_ioctl_data struct {
+	read_write uint8
+	command    uint8
+	size       uint32
+	data       *i2c_smbus_data
+}
+
+// newMsg creates a message for a buffer, which must be kept alive until the message is submitted
+func newMsg(address uint16, flags uint16, buf []byte) (msg i2c_msg) {
+	msg = i2c_msg{
+		addr:  address,
+		flags: flags,
+		len:   uint16(len(buf)),
+	}
+
+	if len(buf) > 0 {
+		msg.buf = &buf[0]
+	}
+
+	return
+}
+
+// ioctl makes an ioctl call with an integer argument on an open device
+func ioctl(dev *os.File, req uintptr, arg uintptr) (errno syscall.Errno) {
+	_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, dev.Fd(), req, arg)
+	runtime.KeepAlive(dev)
+	return
+}
+
+// rdwrHook and smbusHook receive the I2C_RDWR and I2C_SMBUS requests instead of
+// the kernel if they are set, so that tests can check the requests are marshalled
+// as the kernel reads them. The requests are passed by value so that the hooks do
+// not move the requests of every transaction to the heap.
+var (
+	rdwrHook  func(request i2c_rdwr_ioctl_data) syscall.Errno
+	smbusHook func(request i2c_smbus_ioctl_data) syscall.Errno
+)
+
+// ioctlPtr makes an ioctl call with a pointer argument on an open device. The
+// pointer is only converted to a uintptr in the call expression, so the memory it
+// refers to is kept alive and in place until the system call returns.
+func ioctlPtr(dev *os.File, req uintptr, arg unsafe.Pointer) (errno syscall.Errno) {
+	_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, dev.Fd(), req, uintptr(arg))
+	runtime.KeepAlive(dev)
+	return
+}
@@ -0,0 +1,278 @@
+package piicodev
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestI2CMsgLayout(t *testing.T) {
+	ptr := unsafe.Sizeof(uintptr(0))
+
+	var msg i2c_msg
+	if unsafe.Offsetof(msg.flags) != 2 || unsafe.Offsetof(msg.len) != 4 || unsafe.Offsetof(msg.buf) != 8 || unsafe.Sizeof(msg) != 8+ptr {
+		t.Errorf("i2c_msg does not match the kernel layout")
+	}
+
+	var data i2c_rdwr_ioctl_data
+	if unsafe.Offsetof(data.nmsg) != ptr || unsafe.Sizeof(data) != 2*ptr {
+		t.Errorf("i2c_rdwr_ioctl_data does not match the kernel layout")
+	}
+
+	var smbus i2c_smbus_ioctl_data
+	if unsafe.Offsetof(smbus.command) != 1 || unsafe.Offsetof(smbus.size) != 4 || unsafe.Offsetof(smbus.data) != 8 || unsafe.Sizeof(i2c_smbus_data{}) != 34 {
+		t.Errorf("i2c_smbus_ioctl_data does not match the kernel layout")
+	}
+
+	buf := make([]byte, 3)
+	if msg = newMsg(0x29, I2C_M_RD, buf); msg.addr != 0x29 || msg.flags != I2C_M_RD || msg.len != 3 || msg.buf != &buf[0] {
+		t.Errorf("Message for the buffer is %+v", msg)
+	}
+
+	if msg = newMsg(0x29, 0, nil); msg.len != 0 || msg.buf != nil {
+		t.Errorf("Message for no buffer is %+v", msg)
+	}
+}
+
+// TestIoctlMarshalling submits transactions to a file that is not an adapter, which
+// fails with ENOTTY after the request has been passed to the kernel. Run with -race
+// to check the pointer handling with checkptr.
+func TestIoctlMarshalling(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "i2c")
+	if err != nil {
+		t.Fatalf("Error creating a file: %v", err)
+	}
+
+	b := &Bus{dev: f, locks: make(map[uint16]*sync.Mutex), slave: -1, funcs: ^Functionality(0)}
+	defer b.Close()
+
+	i2c := b.Open(0x29)
+	buf := make([]byte, 17)
+
+	for _, err = range []error{
+		i2c.ReadRegInto(0x01, buf),
+		i2c.ReadReg16Into(0x0089, buf),
+		i2c.WriteReg16U16BE(0x001E, 0x0102),
+		i2c.Transfer(Msg{Data: []byte{0x01}}, Msg{Read: true, Data: buf}),
+	} {
+		if !errors.Is(err, syscall.ENOTTY) {
+			t.Errorf("Transaction with a file returned %v rather than ENOTTY", err)
+		}
+	}
+}
+
+// kernelLayout is the layout of the i2c-dev structures in the kernel ABI of an architecture
+type kernelLayout struct {
+	msgSize, msgLen, msgBuf            uintptr // struct i2c_msg
+	rdwrSize, rdwrNmsgs                uintptr // struct i2c_rdwr_ioctl_data
+	smbusSize, smbusSizeArg, smbusData uintptr // struct i2c_smbus_ioctl_data
+}
+
+var (
+	kernelLayout64 = kernelLayout{16, 4, 8, 16, 8, 16, 4, 8}
+	kernelLayout32 = kernelLayout{12, 4, 8, 8, 4, 12, 4, 8}
+)
+
+// kernelLayouts are the layouts of the kernel structures for each GOARCH
+var kernelLayouts = map[string]kernelLayout{
+	"amd64": kernelLayout64, "arm64": kernelLayout64, "riscv64": kernelLayout64, "loong64": kernelLayout64,
+	"ppc64": kernelLayout64, "ppc64le": kernelLayout64, "s390x": kernelLayout64, "mips64": kernelLayout64, "mips64le": kernelLayout64,
+	"386": kernelLayout32, "arm": kernelLayout32, "mips": kernelLayout32, "mipsle": kernelLayout32,
+}
+
+// kernelMsg is a message read from an I2C_RDWR request
+type kernelMsg struct {
+	addr, flags uint16
+	data        []byte
+}
+
+// hookIoctls makes the I2C_RDWR and I2C_SMBUS ioctl calls of the test call fn
+// with a pointer to the request instead of the kernel
+func hookIoctls(t *testing.T, fn func(req uintptr, arg unsafe.Pointer) syscall.Errno) {
+	rdwrHook = func(request i2c_rdwr_ioctl_data) syscall.Errno { return fn(I2C_RDWR, unsafe.Pointer(&request)) }
+	smbusHook = func(request i2c_smbus_ioctl_data) syscall.Errno { return fn(I2C_SMBUS, unsafe.Pointer(&request)) }
+	t.Cleanup(func() { rdwrHook, smbusHook = nil, nil })
+}
+
+// TestIoctlKernelLayout reads the requests passed to the ioctl hooks with the layout of
+// the kernel structures for the GOARCH, as the kernel would, filling the read
+// buffers after a garbage collection. Run with -race to check the pointers with checkptr.
+func TestIoctlKernelLayout(t *testing.T) {
+	k, ok := kernelLayouts[runtime.GOARCH]
+	if !ok {
+		t.Skipf("No kernel layout for %s", runtime.GOARCH)
+	}
+
+	var msg i2c_msg
+	var rdwr i2c_rdwr_ioctl_data
+	var smbus i2c_smbus_ioctl_data
+	if unsafe.Sizeof(msg) != k.msgSize || unsafe.Offsetof(msg.len) != k.msgLen || unsafe.Offsetof(msg.buf) != k.msgBuf ||
+		unsafe.Sizeof(rdwr) != k.rdwrSize || unsafe.Offsetof(rdwr.nmsg) != k.rdwrNmsgs ||
+		unsafe.Sizeof(smbus) != k.smbusSize || unsafe.Offsetof(smbus.size) != k.smbusSizeArg || unsafe.Offsetof(smbus.data) != k.smbusData {
+		t.Fatalf("The ioctl structures do not match the kernel layout for %s", runtime.GOARCH)
+	}
+
+	var msgs []kernelMsg
+	var commands []byte
+	hookIoctls(t, func(req uintptr, arg unsafe.Pointer) syscall.Errno {
+		runtime.GC()
+
+		switch req {
+		case I2C_RDWR:
+			first := *(*unsafe.Pointer)(arg)
+			for i := uintptr(0); i < uintptr(*(*uint32)(unsafe.Add(arg, k.rdwrNmsgs))); i++ {
+				m := unsafe.Add(first, i*k.msgSize)
+				km := kernelMsg{addr: *(*uint16)(m), flags: *(*uint16)(unsafe.Add(m, 2))}
+				km.data = unsafe.Slice((*byte)(*(*unsafe.Pointer)(unsafe.Add(m, k.msgBuf))), *(*uint16)(unsafe.Add(m, k.msgLen)))
+
+				if km.flags&I2C_M_RD != 0 {
+					for j := range km.data {
+						km.data[j] = byte(0xA0 + j)
+					}
+				}
+
+				km.data = append([]byte{}, km.data...)
+				msgs = append(msgs, km)
+			}
+		case I2C_SMBUS:
+			command := *(*uint8)(unsafe.Add(arg, 1))
+			data := (*i2c_smbus_data)(*(*unsafe.Pointer)(unsafe.Add(arg, k.smbusData)))
+			if *(*uint8)(arg) == I2C_SMBUS_READ && *(*uint32)(unsafe.Add(arg, k.smbusSizeArg)) == uint32(SMBusByteData) {
+				data[0] = command + 1
+			}
+
+			commands = append(commands, command)
+		default:
+			return syscall.ENOTTY
+		}
+
+		return 0
+	})
+
+	b := &Bus{bus: 1, locks: make(map[uint16]*sync.Mutex), slave: 0x29, funcs: ^Functionality(0)}
+	i2c := b.Open(0x29)
+
+	buf := make([]byte, 17)
+	if err := i2c.ReadRegInto(0x01, buf); err != nil || buf[0] != 0xA0 || buf[16] != 0xB0 {
+		t.Errorf("Read %X (%v) from the kernel", buf, err)
+	}
+
+	if err := i2c.Transfer(Msg{Data: []byte{0x01, 0x02}}, Msg{Read: true, Data: make([]byte, 2)}, Msg{Data: []byte{0x03}}); err != nil {
+		t.Errorf("Error making a transfer: %v", err)
+	}
+
+	expected := []kernelMsg{
+		{0x29, 0, []byte{0x01}},
+		{0x29, I2C_M_RD, buf},
+		{0x29, 0, []byte{0x01, 0x02}},
+		{0x29, I2C_M_RD, []byte{0xA0, 0xA1}},
+		{0x29, 0, []byte{0x03}},
+	}
+
+	if len(msgs) != len(expected) {
+		t.Fatalf("Kernel read %d messages rather than %d", len(msgs), len(expected))
+	}
+
+	for i, m := range expected {
+		if msgs[i].addr != m.addr || msgs[i].flags != m.flags || !bytes.Equal(msgs[i].data, m.data) {
+			t.Errorf("Kernel read message %d as %+v rather than %+v", i, msgs[i], m)
+		}
+	}
+
+	if v, err := i2c.SMBusReadByteData(0x10); err != nil || v != 0x11 || !bytes.Equal(commands, []byte{0x10}) {
+		t.Errorf("SMBus read 0x%X (%v) with the commands %X", v, err, commands)
+	}
+}
+
+func TestFunctionality(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "i2c")
+	if err != nil {
+		t.Fatalf("Error creating a file: %v", err)
+	}
+
+	b := &Bus{dev: f, locks: make(map[uint16]*sync.Mutex), slave: -1, funcs: FuncSMBusQuick | FuncSMBusReadByteData}
+	defer b.Close()
+
+	if s := b.Functionality().String(); s != "SMBus quick, SMBus read byte data" {
+		t.Errorf("Functionality is %q", s)
+	}
+
+	i2c := b.Open(0x29)
+	if f, err := i2c.Functionality(); err != nil || f != b.Functionality() {
+		t.Errorf("Device functionality is %v (%v)", f, err)
+	}
+
+	for _, err = range []error{
+		i2c.ReadRegInto(0x01, make([]byte, 2)),
+		i2c.SMBusWriteByteData(0x01, 0x02),
+		i2c.SetPEC(true),
+	} {
+		if !errors.Is(err, ErrNotSupported) {
+			t.Errorf("Unsupported transaction returned %v", err)
+		}
+	}
+
+	if _, err = i2c.SMBusReadByteData(0x01); !errors.Is(err, syscall.ENOTTY) {
+		t.Errorf("Supported transaction returned %v rather than ENOTTY from the file", err)
+	}
+
+	if err = b.SetAdapterTimeout(time.Second); !errors.Is(err, syscall.ENOTTY) {
+		t.Errorf("Setting the timeout of a file returned %v", err)
+	}
+}
+
+func TestTenBitAddress(t *testing.T) {
+	buf := make([]byte, 1)
+	if msg := newMsg(0x3A5, I2C_M_TEN|I2C_M_RD, buf); msg.addr != 0x3A5 || msg.flags != I2C_M_TEN|I2C_M_RD {
+		t.Errorf("Message for a 10-bit address is %+v", msg)
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "i2c")
+	if err != nil {
+		t.Fatalf("Error creating a file: %v", err)
+	}
+
+	b := &Bus{dev: f, locks: make(map[uint16]*sync.Mutex), slave: -1, funcs: FuncI2C | FuncSMBusReadByteData}
+	defer b.Close()
+
+	i2c := b.Open10(0x3A5)
+	if i2c.Address() != 0x3A5 || !i2c.TenBit() {
+		t.Errorf("Handle is at address 0x%X with 10-bit %v", i2c.Address(), i2c.TenBit())
+	}
+
+	if b.addressLock(slaveAddr{address: 0x50}) == b.addressLock(slaveAddr{address: 0x50, tenBit: true}) {
+		t.Errorf("7-bit and 10-bit addresses share a lock")
+	}
+
+	err = i2c.ReadRegInto(0x01, buf)
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("10-bit read without adapter support returned %v", err)
+	}
+
+	if s := err.Error(); s != "failed to read from I2C register 0x1 at 10-bit address 0x3A5 on bus 0: operation not supported" {
+		t.Errorf("10-bit error message is %q", s)
+	}
+
+	if _, err = i2c.SMBusReadByteData(0x01); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("10-bit SMBus read without adapter support returned %v", err)
+	}
+
+	if _, err = b.ScanTenBit(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("10-bit scan without adapter support returned %v", err)
+	}
+
+	b.funcs |= Func10BitAddr
+	if err = i2c.ReadRegInto(0x01, buf); !errors.Is(err, syscall.ENOTTY) {
+		t.Errorf("10-bit read with adapter support returned %v rather than ENOTTY", err)
+	}
+
+	if _, err = i2c.SMBusReadByteData(0x01); !errors.Is(err, syscall.ENOTTY) || b.tenBit || b.slave != -1 {
+		t.Errorf("10-bit SMBus read returned %v with I2C_TENBIT %v and address %d", err, b.tenBit, b.slave)
+	}
+}
@@ -0,0 +1,42 @@
+// Kernel drivers bound to I2C addresses
+package piicodev
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// KernelDriver returns the name of the kernel driver bound to an address on a bus
+// from /sys/bus/i2c/devices, or an empty string if there is none. While a driver
+// is bound, such as lm75 or tmp102 from a device tree overlay, OpenI2C fails and
+// the SMBus transactions of devices opened on a Bus fail with an error matching
+// ErrBusy unless the device is opened with force.
+func KernelDriver(bus int, address uint8) (driver string, err error) {
+	return kernelDriver(bus, slaveAddr{address: uint16(address)})
+}
+
+// kernelDriver returns the kernel driver bound to a 7-bit or 10-bit address. The
+// kernel names the devices at 10-bit addresses with an offset of 0xA000.
+func kernelDriver(bus int, a slaveAddr) (driver string, err error) {
+	name := a.address
+	if a.tenBit {
+		name |= 0xA000
+	}
+
+	var target string
+	target, err = os.Readlink(filepath.Join(sysfsRoot, "bus", "i2c", "devices", fmt.Sprintf("%d-%04x", bus, name), "driver"))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return
+	}
+
+	driver = filepath.Base(target)
+	return
+}
+
+// KernelDriver returns the name of the kernel driver bound to an address on the bus, if any
+func (b *Bus) KernelDriver(address uint8) (driver string, err error) {
+	return KernelDriver(b.bus, address)
+}
@@ -14,12 +14,17 @@ const (
 )
 
 func NewLM75A(addr uint8, bus int) (s *LM75A, err error) {
-	s = new(LM75A)
-
-	if s.i2c, err = OpenI2C(addr, bus); err != nil {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
 		return
 	}
 
+	return NewLM75AWithConn(i2c)
+}
+
+// NewLM75AWithConn creates a new LM75A instance on an already open connection
+func NewLM75AWithConn(conn Conn) (s *LM75A, err error) {
+	s = &LM75A{i2c: NewI2C(conn)}
 	return
 }
 
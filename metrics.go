@@ -0,0 +1,301 @@
+// Collecting metrics of the I2C transactions made with devices
+package piicodev
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds of the latency histogram buckets
+// used when NewMetrics is not given any
+var DefaultLatencyBuckets = []time.Duration{
+	100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond,
+}
+
+// Histogram is a distribution of transaction latencies
+type Histogram struct {
+	Buckets []time.Duration // the upper bounds of the buckets
+	Counts  []uint64        // the number in each bucket, with a final bucket for those above the last bound
+	Count   uint64          // the total number of transactions
+	Sum     time.Duration   // the total latency of the transactions
+}
+
+// observe adds a latency to the histogram
+func (h *Histogram) observe(d time.Duration) {
+	i := sort.Search(len(h.Buckets), func(i int) bool { return d <= h.Buckets[i] })
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+}
+
+// DeviceMetrics are the metrics of the transactions with the device at an address on a bus
+type DeviceMetrics struct {
+	Bus          int    // the bus number, or -1 if the connection is not on a Bus
+	Channel      int    // the multiplexer channel, or -1 if the device is not behind a multiplexer
+	Address      uint16 // the device address
+	TenBit       bool   // the address is a 10-bit address
+	Transactions uint64 // the number of transactions including retries and failures
+	Bytes        uint64 // the number of bytes read and written by successful transactions
+	Errors       map[syscall.Errno]uint64
+	Retries      uint64 // the number of transactions that retried a failed transaction
+	Latency      Histogram
+}
+
+// deviceKey identifies a device in the metrics
+type deviceKey struct {
+	bus     int
+	channel int
+	address uint16
+	tenBit  bool
+}
+
+// Metrics is a Tracer that counts the transactions, bytes, errors and retries of
+// each device and records histograms of their latency. The probes of a scan are
+// only counted per bus, so that scanning does not add every address as a device.
+// Metrics are opt-in: set it as the tracer of a Bus or device, with MultiTracer
+// to also log them.
+type Metrics struct {
+	mu      sync.Mutex
+	buckets []time.Duration
+	devices map[deviceKey]*DeviceMetrics
+	probes  map[int]uint64 // the number of probes of each bus
+}
+
+// NewMetrics creates metrics with latency histograms using the bucket upper
+// bounds in increasing order, or DefaultLatencyBuckets if none are given
+func NewMetrics(buckets ...time.Duration) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+
+	return &Metrics{
+		buckets: append([]time.Duration{}, buckets...),
+		devices: make(map[deviceKey]*DeviceMetrics),
+		probes:  make(map[int]uint64),
+	}
+}
+
+// Trace counts a transaction
+func (m *Metrics) Trace(tx *Transaction) {
+	k := deviceKey{bus: tx.Bus, channel: tx.Channel, address: tx.Address, tenBit: tx.TenBit}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if tx.Op == OpProbe {
+		m.probes[tx.Bus]++
+		return
+	}
+
+	d, ok := m.devices[k]
+	if !ok {
+		d = &DeviceMetrics{
+			Bus:     tx.Bus,
+			Channel: tx.Channel,
+			Address: tx.Address,
+			TenBit:  tx.TenBit,
+			Errors:  make(map[syscall.Errno]uint64),
+			Latency: Histogram{Buckets: m.buckets, Counts: make([]uint64, len(m.buckets)+1)},
+		}
+		m.devices[k] = d
+	}
+
+	d.Transactions++
+	if tx.Retry {
+		d.Retries++
+	}
+
+	if tx.Err != nil {
+		d.Errors[tx.Errno]++
+	} else {
+		d.Bytes += uint64(len(tx.Data))
+	}
+
+	d.Latency.observe(tx.Duration)
+}
+
+// Devices returns a copy of the metrics of every device with a transaction other
+// than a probe, ordered by bus, channel and address
+func (m *Metrics) Devices() (devices []DeviceMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, d := range m.devices {
+		c := *d
+		c.Errors = make(map[syscall.Errno]uint64, len(d.Errors))
+		for errno, n := range d.Errors {
+			c.Errors[errno] = n
+		}
+
+		c.Latency.Counts = append([]uint64{}, d.Latency.Counts...)
+		devices = append(devices, c)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		a, b := &devices[i], &devices[j]
+		if a.Bus != b.Bus {
+			return a.Bus < b.Bus
+		}
+
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+
+		if a.TenBit != b.TenBit {
+			return !a.TenBit
+		}
+
+		return a.Address < b.Address
+	})
+
+	return
+}
+
+// Device returns the metrics of the device at a 7-bit address on a bus, not
+// behind a multiplexer, or false if there has not been a transaction with it
+func (m *Metrics) Device(bus int, address uint8) (d DeviceMetrics, ok bool) {
+	for _, d = range m.Devices() {
+		if d.Bus == bus && d.Channel < 0 && d.Address == uint16(address) && !d.TenBit {
+			return d, true
+		}
+	}
+
+	return DeviceMetrics{}, false
+}
+
+// Probes returns the number of addresses probed by scans of a bus
+func (m *Metrics) Probes(bus int) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.probes[bus]
+}
+
+// Reset discards the metrics of all the devices and buses
+func (m *Metrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.devices = make(map[deviceKey]*DeviceMetrics)
+	m.probes = make(map[int]uint64)
+}
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format,
+// labelled with the bus and address of each device, and the channel of a device
+// behind a multiplexer
+func (m *Metrics) WritePrometheus(w io.Writer) (err error) {
+	devices := m.Devices()
+	bw := bufio.NewWriter(w)
+
+	m.mu.Lock()
+	buses := make([]int, 0, len(m.probes))
+	probes := make(map[int]uint64, len(m.probes))
+	for bus, n := range m.probes {
+		buses = append(buses, bus)
+		probes[bus] = n
+	}
+	m.mu.Unlock()
+	sort.Ints(buses)
+
+	labels := func(d *DeviceMetrics) string {
+		if d.Channel >= 0 {
+			return fmt.Sprintf("bus=%q,channel=%q,address=%q", strconv.Itoa(d.Bus), strconv.Itoa(d.Channel), formatTraceAddress(d.Address, d.TenBit))
+		}
+
+		return fmt.Sprintf("bus=%q,address=%q", strconv.Itoa(d.Bus), formatTraceAddress(d.Address, d.TenBit))
+	}
+
+	header := func(name, kind, help string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	header("piicodev_i2c_transactions_total", "counter", "I2C transactions made with the device including retries and failures.")
+	for i := range devices {
+		fmt.Fprintf(bw, "piicodev_i2c_transactions_total{%s} %d\n", labels(&devices[i]), devices[i].Transactions)
+	}
+
+	header("piicodev_i2c_bytes_total", "counter", "Bytes read and written by successful I2C transactions with the device.")
+	for i := range devices {
+		fmt.Fprintf(bw, "piicodev_i2c_bytes_total{%s} %d\n", labels(&devices[i]), devices[i].Bytes)
+	}
+
+	header("piicodev_i2c_errors_total", "counter", "Failed I2C transactions with the device by errno.")
+	for i := range devices {
+		d := &devices[i]
+
+		errnos := make([]syscall.Errno, 0, len(d.Errors))
+		for errno := range d.Errors {
+			errnos = append(errnos, errno)
+		}
+		sort.Slice(errnos, func(i, j int) bool { return errnos[i] < errnos[j] })
+
+		for _, errno := range errnos {
+			fmt.Fprintf(bw, "piicodev_i2c_errors_total{%s,errno=\"%d\",error=%q} %d\n", labels(d), int(errno), errnoText(errno), d.Errors[errno])
+		}
+	}
+
+	header("piicodev_i2c_retries_total", "counter", "I2C transactions with the device that retried a failed transaction.")
+	for i := range devices {
+		fmt.Fprintf(bw, "piicodev_i2c_retries_total{%s} %d\n", labels(&devices[i]), devices[i].Retries)
+	}
+
+	header("piicodev_i2c_probes_total", "counter", "Addresses probed by scans of the bus.")
+	for _, bus := range buses {
+		fmt.Fprintf(bw, "piicodev_i2c_probes_total{bus=%q} %d\n", strconv.Itoa(bus), probes[bus])
+	}
+
+	header("piicodev_i2c_transaction_duration_seconds", "histogram", "Latency of the I2C transactions with the device.")
+	for i := range devices {
+		d := &devices[i]
+		l := labels(d)
+
+		var cumulative uint64
+		for b, bound := range d.Latency.Buckets {
+			cumulative += d.Latency.Counts[b]
+			fmt.Fprintf(bw, "piicodev_i2c_transaction_duration_seconds_bucket{%s,le=\"%s\"} %d\n", l, formatSeconds(bound), cumulative)
+		}
+
+		fmt.Fprintf(bw, "piicodev_i2c_transaction_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", l, d.Latency.Count)
+		fmt.Fprintf(bw, "piicodev_i2c_transaction_duration_seconds_sum{%s} %s\n", l, formatSeconds(d.Latency.Sum))
+		fmt.Fprintf(bw, "piicodev_i2c_transaction_duration_seconds_count{%s} %d\n", l, d.Latency.Count)
+	}
+
+	return bw.Flush()
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format, or an
+// internal server error if they cannot be written
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var b bytes.Buffer
+	if err := m.WritePrometheus(&b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(b.Bytes())
+}
+
+// formatSeconds formats a duration as seconds for Prometheus
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
+
+// errnoText describes an errno, or is empty for an error without an errno
+func errnoText(errno syscall.Errno) string {
+	if errno == 0 {
+		return ""
+	}
+
+	return errno.Error()
+}
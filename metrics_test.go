@@ -0,0 +1,127 @@
+package piicodev
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestMetrics(t *testing.T) {
+	f := NewFakeConn()
+	f.SetReg(0x10, 0x01, 0x02)
+
+	m := NewMetrics(time.Millisecond, 10*time.Millisecond)
+	i2c := NewI2C(f)
+	i2c.SetTracer(MultiTracer(m, TracerFunc(func(tx *Transaction) {})))
+	i2c.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2})
+
+	f.QueueError(&I2CError{Op: "read", Bus: -1, Reg: 0x10, Errno: syscall.EREMOTEIO})
+	if _, err := i2c.ReadRegU16BE(0x10); err != nil {
+		t.Fatalf("Error reading after a retry: %v", err)
+	}
+
+	if err := i2c.WriteRegU8(0x11, 0x03); err != nil {
+		t.Fatalf("Error writing: %v", err)
+	}
+
+	d, ok := m.Device(-1, 0)
+	if !ok {
+		t.Fatalf("No metrics for the device")
+	}
+
+	if d.Transactions != 3 || d.Bytes != 3 || d.Retries != 1 || d.Errors[syscall.EREMOTEIO] != 1 || d.Latency.Count != 3 {
+		t.Errorf("Device metrics are %+v", d)
+	}
+
+	if _, ok = m.Device(1, 0x29); ok {
+		t.Errorf("Metrics for a device without transactions")
+	}
+
+	// the same address behind a multiplexer is a separate device
+	m.Trace(&Transaction{Op: OpRead, Bus: -1, Channel: 2, Address: 0, Data: []byte{0x01}})
+	if devices := m.Devices(); len(devices) != 2 || devices[0].Channel != -1 || devices[1].Channel != 2 || devices[1].Transactions != 1 {
+		t.Errorf("Devices are %+v", devices)
+	}
+
+	if d, _ = m.Device(-1, 0); d.Transactions != 3 {
+		t.Errorf("Device not behind a multiplexer has %d transactions", d.Transactions)
+	}
+
+	var b bytes.Buffer
+	if err := m.WritePrometheus(&b); err != nil {
+		t.Fatalf("Error writing the metrics: %v", err)
+	}
+
+	for _, line := range []string{
+		"# TYPE piicodev_i2c_transactions_total counter",
+		`piicodev_i2c_transactions_total{bus="-1",address="0x00"} 3`,
+		`piicodev_i2c_bytes_total{bus="-1",address="0x00"} 3`,
+		`piicodev_i2c_errors_total{bus="-1",address="0x00",errno="121",error="remote I/O error"} 1`,
+		`piicodev_i2c_retries_total{bus="-1",address="0x00"} 1`,
+		`piicodev_i2c_transaction_duration_seconds_bucket{bus="-1",address="0x00",le="+Inf"} 3`,
+		`piicodev_i2c_transaction_duration_seconds_count{bus="-1",address="0x00"} 3`,
+		`piicodev_i2c_transactions_total{bus="-1",channel="2",address="0x00"} 1`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("Prometheus metrics do not contain %q:\n%s", line, b.String())
+		}
+	}
+
+	m.Reset()
+	if len(m.Devices()) != 0 {
+		t.Errorf("Metrics were not reset")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := Histogram{Buckets: []time.Duration{time.Millisecond, 10 * time.Millisecond}, Counts: make([]uint64, 3)}
+	for _, d := range []time.Duration{time.Microsecond, time.Millisecond, 5 * time.Millisecond, time.Second} {
+		h.observe(d)
+	}
+
+	if h.Counts[0] != 2 || h.Counts[1] != 1 || h.Counts[2] != 1 || h.Count != 4 {
+		t.Errorf("Histogram counts are %v of %d", h.Counts, h.Count)
+	}
+}
+
+func TestMetricsScan(t *testing.T) {
+	hookIoctls(t, func(req uintptr, arg unsafe.Pointer) syscall.Errno {
+		if req == I2C_RDWR {
+			return syscall.ENXIO
+		}
+
+		return 0
+	})
+
+	m := NewMetrics()
+	b := &Bus{bus: 1, locks: make(map[uint16]*sync.Mutex), slave: -1, funcs: FuncI2C}
+	b.SetTracer(m)
+
+	if results, err := b.Scan(); err != nil || len(results) != 0 {
+		t.Fatalf("Scan of an empty bus found %v (%v)", results, err)
+	}
+
+	if devices := m.Devices(); len(devices) != 0 {
+		t.Errorf("Scan added the metrics of %d devices", len(devices))
+	}
+
+	if n := m.Probes(1); n != ScanLastAddress-ScanFirstAddress+1 {
+		t.Errorf("Counted %d probes of the bus", n)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4" {
+		t.Errorf("Metrics served as %q", ct)
+	}
+
+	if line := `piicodev_i2c_probes_total{bus="1"} 112`; !strings.Contains(rec.Body.String(), line+"\n") {
+		t.Errorf("Served metrics do not contain %q:\n%s", line, rec.Body.String())
+	}
+}
@@ -2,6 +2,8 @@
 package piicodev
 
 import (
+	"context"
+	"encoding/binary"
 	"time"
 )
 
@@ -67,24 +69,46 @@ const (
 
 	ACCEL_CONFIG = 0x1C
 	GYRO_CONFIG  = 0x1B
+
+	WHO_AM_I       = 0x75
+	WHO_AM_I_VALUE = 0x68
 )
 
 type MPU6050 struct {
 	i2c *I2C
+	buf [6]byte
 }
 
 func NewMPU6050(addr uint8, bus int) (t *MPU6050, err error) {
-	t = &MPU6050{}
-	if t.i2c, err = OpenI2C(addr, bus); err != nil {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
 		return
 	}
 
+	return NewMPU6050WithConn(i2c)
+}
+
+// NewMPU6050WithConn creates a new MPU6050 instance on an already open connection
+func NewMPU6050WithConn(conn Conn) (t *MPU6050, err error) {
+	return NewMPU6050WithConnContext(context.Background(), conn)
+}
+
+// NewMPU6050WithConnContext creates a new MPU6050 instance on an already open
+// connection, stopping the waits for the wake up if the context is done
+func NewMPU6050WithConnContext(ctx context.Context, conn Conn) (t *MPU6050, err error) {
+	i2c := NewI2C(conn)
+	t = &MPU6050{i2c: i2c.withContext(ctx)}
+	defer func() { t.i2c = i2c }()
+
 	// Wake up the MPU-6050 since it starts in sleep mode
 	for i := 0; i < 3; i++ {
 		if err = t.i2c.WriteRegU8(PWR_MGMT_1, 0); err != nil {
 			return
 		}
-		time.Sleep(5 * time.Millisecond)
+
+		if err = t.i2c.sleep(ctx, 5*time.Millisecond); err != nil {
+			return
+		}
 	}
 
 	return
@@ -154,15 +178,7 @@ func (t *MPU6050) ReadAccelData() (x, y, z float64, err error) {
 	}
 
 	var aX, aY, aZ int16
-	if aX, err = t.i2c.ReadRegS16BE(ACCEL_XOUT0); err != nil {
-		return
-	}
-
-	if aY, err = t.i2c.ReadRegS16BE(ACCEL_YOUT0); err != nil {
-		return
-	}
-
-	if aZ, err = t.i2c.ReadRegS16BE(ACCEL_ZOUT0); err != nil {
+	if aX, aY, aZ, err = t.readXYZ(ACCEL_XOUT0); err != nil {
 		return
 	}
 
@@ -227,15 +243,7 @@ func (t *MPU6050) ReadGyroData() (x, y, z float64, err error) {
 	}
 
 	var gX, gY, gZ int16
-	if gX, err = t.i2c.ReadRegS16BE(GYRO_XOUT0); err != nil {
-		return
-	}
-
-	if gY, err = t.i2c.ReadRegS16BE(GYRO_YOUT0); err != nil {
-		return
-	}
-
-	if gZ, err = t.i2c.ReadRegS16BE(GYRO_ZOUT0); err != nil {
+	if gX, gY, gZ, err = t.readXYZ(GYRO_XOUT0); err != nil {
 		return
 	}
 
@@ -246,6 +254,22 @@ func (t *MPU6050) ReadGyroData() (x, y, z float64, err error) {
 	return
 }
 
+// readXYZ reads the three consecutive 16-bit signed values of a sensor in one
+// transaction, so that they are from the same sample
+func (t *MPU6050) readXYZ(reg byte) (x, y, z int16, err error) {
+	t.i2c.Lock()
+	defer t.i2c.Unlock()
+
+	if err = t.i2c.ReadRegInto(reg, t.buf[:]); err != nil {
+		return
+	}
+
+	x = int16(binary.BigEndian.Uint16(t.buf[0:2]))
+	y = int16(binary.BigEndian.Uint16(t.buf[2:4]))
+	z = int16(binary.BigEndian.Uint16(t.buf[4:6]))
+	return
+}
+
 func (t *MPU6050) Close() {
 	t.i2c.Close()
 }
@@ -3,6 +3,7 @@
 package piicodev
 
 import (
+	"context"
 	"time"
 )
 
@@ -64,16 +65,33 @@ type MS5637 struct {
 }
 
 func NewMS5637(addr uint8, bus int) (p *MS5637, err error) {
-	p = &MS5637{}
-	if p.i2c, err = OpenI2C(addr, bus); err != nil {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
 		return
 	}
 
+	return NewMS5637WithConn(i2c)
+}
+
+// NewMS5637WithConn creates a new MS5637 instance on an already open connection
+func NewMS5637WithConn(conn Conn) (p *MS5637, err error) {
+	return NewMS5637WithConnContext(context.Background(), conn)
+}
+
+// NewMS5637WithConnContext creates a new MS5637 instance on an already open
+// connection, stopping the wait for the reset if the context is done
+func NewMS5637WithConnContext(ctx context.Context, conn Conn) (p *MS5637, err error) {
+	i2c := NewI2C(conn)
+	p = &MS5637{i2c: i2c.withContext(ctx)}
+	defer func() { p.i2c = i2c }()
+
 	if err = p.i2c.WriteU8(_SOFTRESET); err != nil {
 		return
 	}
 
-	time.Sleep(15 * time.Millisecond)
+	if err = p.i2c.sleep(ctx, 15*time.Millisecond); err != nil {
+		return
+	}
 
 	p.coeffs, err = p.ReadEEPROMCoeffs()
 	p.SetResolution(_RESOLUTION_OSR_8192)
@@ -117,26 +135,38 @@ func (p *MS5637) getCoeff(coeff int) int64 {
 	return int64(p.coeffs[coeff])
 }
 
-func (p *MS5637) readADC(param *MS5637ADCParams) (val uint32, err error) {
-	if err = p.i2c.WriteU8(param.cmd); err != nil {
+func (p *MS5637) readADC(ctx context.Context, param *MS5637ADCParams) (val uint32, err error) {
+	i2c := p.i2c.withContext(ctx)
+	i2c.Lock()
+	defer i2c.Unlock()
+
+	if err = i2c.WriteU8(param.cmd); err != nil {
 		return
 	}
 
-	time.Sleep(param.conversionTime * time.Millisecond)
+	if err = i2c.sleep(ctx, param.conversionTime*time.Millisecond); err != nil {
+		return
+	}
 
-	val, err = p.i2c.ReadRegU24BE(_ADC_READ)
+	val, err = i2c.ReadRegU24BE(_ADC_READ)
 	return
 }
 
 func (p *MS5637) Read() (pressure float64, temperature float64, err error) {
+	return p.ReadContext(context.Background())
+}
+
+// ReadContext reads the pressure and temperature, stopping the wait for the
+// conversions if the context is done
+func (p *MS5637) ReadContext(ctx context.Context) (pressure float64, temperature float64, err error) {
 	var adc_temperature, adc_pressure uint32
 	var dT, temp, off, sens, pr, t2, off2, sens2 int64
 
-	if adc_temperature, err = p.readADC(&(p.tempParam)); err != nil {
+	if adc_temperature, err = p.readADC(ctx, &(p.tempParam)); err != nil {
 		return
 	}
 
-	if adc_pressure, err = p.readADC(&(p.pressureParam)); err != nil {
+	if adc_pressure, err = p.readADC(ctx, &(p.pressureParam)); err != nil {
 		return
 	}
 
@@ -1,8 +1,6 @@
 // Core Electronics PiicoDev Potentiometer
 package piicodev
 
-import "fmt"
-
 type Potentiometer struct {
 	i2c              *I2C
 	potType          uint16
@@ -25,21 +23,28 @@ const (
 )
 
 func NewPotentiometer(addr uint8, bus int) (s *Potentiometer, err error) {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
+		return
+	}
+
+	return NewPotentiometerWithConn(i2c)
+}
+
+// NewPotentiometerWithConn creates a new Potentiometer instance on an already open connection
+func NewPotentiometerWithConn(conn Conn) (s *Potentiometer, err error) {
 	s = &Potentiometer{
+		i2c:     NewI2C(conn),
 		minimum: 0.0,
 		maximum: 100.0,
 	}
 
-	if s.i2c, err = OpenI2C(addr, bus); err != nil {
-		return
-	}
-
 	if s.potType, err = s.i2c.ReadRegU16BE(_POT_REG_WHOAMI); err != nil {
 		return
 	}
 
 	if s.potType != _DEVICE_ID_POT && s.potType != _DEVICE_ID_SLIDE {
-		err = fmt.Errorf("the potentiometer type is %d rather than %d (pot) or %d (slide)", s.potType, _DEVICE_ID_POT, _DEVICE_ID_SLIDE)
+		err = &DeviceIDError{Device: "Potentiometer", ID: s.potType, Expected: []uint16{_DEVICE_ID_POT, _DEVICE_ID_SLIDE}}
 		return
 	}
 
@@ -112,6 +117,20 @@ func (s *Potentiometer) ReadValue() (v float64, err error) {
 	return
 }
 
+// SetAddress changes the I2C address of the potentiometer to an address from 0x08
+// to 0x77, moves the handle to the new address and checks that the potentiometer
+// answers there
+func (s *Potentiometer) SetAddress(address uint8) (err error) {
+	s.i2c, err = changeAddress(s.i2c, "Potentiometer", address,
+		func() error { return s.i2c.WriteRegU8(_POT_REG_I2C_ADDRESS|(1<<7), address) },
+		func(i2c *I2C) bool {
+			id, err := i2c.ReadRegU16BE(_POT_REG_WHOAMI)
+			return err == nil && id == s.potType
+		})
+
+	return
+}
+
 // Close closes the handle to the device
 func (s *Potentiometer) Close() {
 	s.i2c.Close()
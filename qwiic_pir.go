@@ -3,8 +3,6 @@
 // The Python implementation: https://github.com/sparkfun/Qwiic_PIR_Py
 package piicodev
 
-import "fmt"
-
 const (
 	QwiicPIRAddress = 0x12
 
@@ -31,18 +29,25 @@ type QwiicPIR struct {
 
 // NewQwiicPIR creates a new QwiicPIR instances
 func NewQwiicPIR(addr uint8, bus int) (p *QwiicPIR, err error) {
-	p = &QwiicPIR{}
-	if p.i2c, err = OpenI2C(addr, bus); err != nil {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
 		return
 	}
 
+	return NewQwiicPIRWithConn(i2c)
+}
+
+// NewQwiicPIRWithConn creates a new QwiicPIR instance on an already open connection
+func NewQwiicPIRWithConn(conn Conn) (p *QwiicPIR, err error) {
+	p = &QwiicPIR{i2c: NewI2C(conn)}
+
 	var deviceID byte
 	if deviceID, err = p.GetDeviceID(); err != nil {
 		return
 	}
 
 	if deviceID != QwiicPIRDeviceID {
-		err = fmt.Errorf("the device ID 0x%x read from the Qwiic PIR does not match 0x%x", deviceID, QwiicPIRDeviceID)
+		err = &DeviceIDError{Device: "QwiicPIR", ID: uint16(deviceID), Expected: []uint16{QwiicPIRDeviceID}}
 		return
 	}
 
@@ -95,6 +100,9 @@ func (p *QwiicPIR) GetDebounceEvents() (available bool, detected bool, removed b
 	detected = false
 	removed = false
 
+	p.i2c.Lock()
+	defer p.i2c.Unlock()
+
 	var eventStatus byte
 	if eventStatus, err = p.i2c.ReadRegU8(QwiicPIREventStatusReg); err != nil {
 		return
@@ -185,6 +193,19 @@ func (p *QwiicPIR) PopRemoveQueue() (firstDetect uint32, err error) {
 	return
 }
 
+// SetAddress changes the I2C address of the QwiicPIR to an address from 0x08 to
+// 0x77, moves the handle to the new address and checks that the QwiicPIR answers there
+func (p *QwiicPIR) SetAddress(address uint8) (err error) {
+	p.i2c, err = changeAddress(p.i2c, "QwiicPIR", address,
+		func() error { return p.i2c.WriteRegU8(QwiicPIRI2cAddressReg, address) },
+		func(i2c *I2C) bool {
+			id, err := i2c.ReadRegU8(QwiicPIRDeviceIDReg)
+			return err == nil && id == QwiicPIRDeviceID
+		})
+
+	return
+}
+
 // Close cleans up the connection for the QwiicPIR instances
 func (p *QwiicPIR) Close() {
 	p.i2c.Close()
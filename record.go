@@ -0,0 +1,706 @@
+// Recording I2C sessions and replaying them for offline regression tests
+package piicodev
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"syscall"
+)
+
+// ErrReplayDivergence is matched by errors for transactions that differ from the recording being replayed
+var ErrReplayDivergence = errors.New("I2C replay diverged from the recording")
+
+// recordedMsg is a single I2C message of a recorded transaction. The data is the
+// hex encoded bytes written, or the bytes read if the transaction succeeded.
+type recordedMsg struct {
+	Read bool   `json:"read,omitempty"`
+	Len  int    `json:"len"`
+	Data string `json:"data,omitempty"`
+}
+
+// recordedSMBus is a recorded SMBus transaction. The data is the hex encoded
+// bytes written and the result the bytes read if the transaction succeeded.
+type recordedSMBus struct {
+	Read     bool          `json:"read,omitempty"`
+	Command  byte          `json:"command"`
+	Protocol SMBusProtocol `json:"protocol"`
+	PEC      bool          `json:"pec,omitempty"`
+	Data     string        `json:"data,omitempty"`
+	Result   string        `json:"result,omitempty"`
+}
+
+// recordedTx is a recorded transaction, stored as one JSON object per line. It is
+// either I2C messages or an SMBus transaction. A failure is recorded as its errno,
+// or as its message and the sentinel error it matched if it has no errno.
+type recordedTx struct {
+	Address uint16         `json:"addr"`
+	TenBit  bool           `json:"ten_bit,omitempty"`
+	Msgs    []recordedMsg  `json:"msgs,omitempty"`
+	SMBus   *recordedSMBus `json:"smbus,omitempty"`
+	Errno   int            `json:"errno,omitempty"`
+	Err     string         `json:"err,omitempty"`
+	Kind    string         `json:"kind,omitempty"`
+}
+
+// recordedKinds are the sentinel errors recorded for failures without an errno
+var recordedKinds = []struct {
+	name string
+	err  error
+}{
+	{"no device", ErrNoDevice},
+	{"busy", ErrBusy},
+	{"timeout", ErrTimeout},
+	{"wrong device", ErrWrongDevice},
+	{"checksum", ErrChecksum},
+	{"not supported", ErrNotSupported},
+	{"invalid length", ErrInvalidLength},
+	{"invalid address", ErrInvalidAddress},
+}
+
+// replayedError is a recorded failure without an errno, which matches the
+// sentinel error that the original error matched
+type replayedError struct {
+	msg  string
+	kind error
+}
+
+func (e *replayedError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the sentinel error, if any
+func (e *replayedError) Unwrap() error {
+	return e.kind
+}
+
+// wireMsgs returns the I2C messages on the wire for a register operation
+func wireMsgs(regBytes []byte, write []byte, readLen int) (msgs []recordedMsg) {
+	msgs = []recordedMsg{{Len: len(regBytes) + len(write), Data: hex.EncodeToString(append(append([]byte{}, regBytes...), write...))}}
+	if readLen > 0 {
+		msgs = append(msgs, recordedMsg{Read: true, Len: readLen})
+	}
+
+	return
+}
+
+// transferMsgs returns the I2C messages of a transfer, with the data read if withReads is set
+func transferMsgs(msgs []Msg, withReads bool) (recorded []recordedMsg) {
+	recorded = make([]recordedMsg, len(msgs))
+	for i, m := range msgs {
+		recorded[i] = recordedMsg{Read: m.Read, Len: len(m.Data)}
+		if !m.Read || withReads {
+			recorded[i].Data = hex.EncodeToString(m.Data)
+		}
+	}
+
+	return
+}
+
+// smbusWritten returns the bytes of the SMBus data written by a transaction
+func smbusWritten(read bool, protocol SMBusProtocol, data []byte) []byte {
+	if read {
+		return nil
+	}
+
+	var buf i2c_smbus_data
+	copy(buf[:], data)
+	return data[:min(len(data), smbusDataLen(protocol, &buf))]
+}
+
+// smbusResult returns the bytes of the SMBus data read by a transaction
+func smbusResult(read bool, protocol SMBusProtocol, data []byte) []byte {
+	if !read && protocol != SMBusProcCall && protocol != SMBusBlockProcCall {
+		return nil
+	}
+
+	var buf i2c_smbus_data
+	copy(buf[:], data)
+	return data[:min(len(data), smbusDataLen(protocol, &buf))]
+}
+
+func reg8Bytes(reg byte) []byte {
+	return []byte{reg}
+}
+
+func reg16Bytes(reg uint16) []byte {
+	return []byte{byte(reg >> 8), byte(reg)}
+}
+
+// connTenBit reports whether the address of a connection is a 10-bit address
+func connTenBit(conn Conn) bool {
+	if t, ok := conn.(interface{ TenBit() bool }); ok {
+		return t.TenBit()
+	}
+
+	return false
+}
+
+// connAddress returns the address of a connection if it has one
+func connAddress(conn Conn) uint16 {
+	if a, ok := conn.(interface{ Address() uint16 }); ok {
+		return a.Address()
+	}
+
+	return 0
+}
+
+// Recorder writes every transaction made through the connections it wraps to a
+// session file, one JSON object per line, for replaying with a Replay. The I2C
+// messages of each transaction and their responses are recorded, as are SMBus
+// transactions.
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder creates a recorder writing a session to w
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w)}
+}
+
+// Wrap returns a connection that records every transaction made with conn. The
+// address recorded is the address of conn, such as a device opened on a Bus. If
+// conn is an *I2C, such as from Bus.Open, the connection returned is an *I2C with
+// the same retry policy, tracer and clock that records each attempt made with the
+// connection it wraps. The locking, SMBus transactions, 10-bit address and Bus
+// defaults of the wrapped connection are kept.
+func (r *Recorder) Wrap(conn Conn) Conn {
+	if i2c, ok := conn.(*I2C); ok {
+		conn = i2c.Conn
+		return i2c.withConn(&recordConn{rec: r, conn: conn, address: connAddress(conn), tenBit: connTenBit(conn)})
+	}
+
+	return &recordConn{rec: r, conn: conn, address: connAddress(conn), tenBit: connTenBit(conn)}
+}
+
+// Err returns the first error writing the session, if any
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+// record writes a transaction to the session, with the data read by its last
+// message if that message is a read and read is not nil
+func (r *Recorder) record(tx recordedTx, read []byte, err error) {
+	if err != nil {
+		var errno syscall.Errno
+		if errors.As(err, &errno) {
+			tx.Errno = int(errno)
+		} else {
+			tx.Err = err.Error()
+			for _, k := range recordedKinds {
+				if errors.Is(err, k.err) {
+					tx.Kind = k.name
+					break
+				}
+			}
+		}
+	} else if n := len(tx.Msgs); read != nil && n > 0 && tx.Msgs[n-1].Read {
+		tx.Msgs[n-1].Data = hex.EncodeToString(read)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err == nil {
+		r.err = r.enc.Encode(&tx)
+	}
+}
+
+// recordConn is a Conn recording the transactions with the connection it wraps
+type recordConn struct {
+	rec     *Recorder
+	conn    Conn
+	address uint16
+	tenBit  bool
+	mu      sync.Mutex
+	pec     bool       // the packet error checking set on the wrapped connection
+	lock    sync.Mutex // the lock of the device if the wrapped connection is not a sync.Locker
+}
+
+func (c *recordConn) Address() uint16 {
+	return c.address
+}
+
+func (c *recordConn) ReadReg(reg byte, length int) (val []byte, err error) {
+	val, err = c.conn.ReadReg(reg, length)
+	c.rec.record(recordedTx{Address: c.address, TenBit: c.tenBit, Msgs: wireMsgs(reg8Bytes(reg), nil, length)}, val, err)
+	return
+}
+
+func (c *recordConn) ReadReg16(reg uint16, length int) (val []byte, err error) {
+	val, err = c.conn.ReadReg16(reg, length)
+	c.rec.record(recordedTx{Address: c.address, TenBit: c.tenBit, Msgs: wireMsgs(reg16Bytes(reg), nil, length)}, val, err)
+	return
+}
+
+// ReadRegInto records a register read into buf, without allocating if the wrapped connection is an IntoReader
+func (c *recordConn) ReadRegInto(reg byte, buf []byte) (err error) {
+	if r, ok := c.conn.(IntoReader); ok {
+		err = r.ReadRegInto(reg, buf)
+	} else {
+		var val []byte
+		val, err = c.conn.ReadReg(reg, len(buf))
+		copy(buf, val)
+	}
+
+	c.rec.record(recordedTx{Address: c.address, TenBit: c.tenBit, Msgs: wireMsgs(reg8Bytes(reg), nil, len(buf))}, buf, err)
+	return
+}
+
+// ReadReg16Into records a register read into buf, without allocating if the wrapped connection is an IntoReader
+func (c *recordConn) ReadReg16Into(reg uint16, buf []byte) (err error) {
+	if r, ok := c.conn.(IntoReader); ok {
+		err = r.ReadReg16Into(reg, buf)
+	} else {
+		var val []byte
+		val, err = c.conn.ReadReg16(reg, len(buf))
+		copy(buf, val)
+	}
+
+	c.rec.record(recordedTx{Address: c.address, TenBit: c.tenBit, Msgs: wireMsgs(reg16Bytes(reg), nil, len(buf))}, buf, err)
+	return
+}
+
+func (c *recordConn) Write(val []byte) (err error) {
+	err = c.conn.Write(val)
+	c.rec.record(recordedTx{Address: c.address, TenBit: c.tenBit, Msgs: wireMsgs(nil, val, 0)}, nil, err)
+	return
+}
+
+func (c *recordConn) WriteReg(reg byte, val []byte) (err error) {
+	err = c.conn.WriteReg(reg, val)
+	c.rec.record(recordedTx{Address: c.address, TenBit: c.tenBit, Msgs: wireMsgs(reg8Bytes(reg), val, 0)}, nil, err)
+	return
+}
+
+func (c *recordConn) WriteReg16(reg uint16, val []byte) (err error) {
+	err = c.conn.WriteReg16(reg, val)
+	c.rec.record(recordedTx{Address: c.address, TenBit: c.tenBit, Msgs: wireMsgs(reg16Bytes(reg), val, 0)}, nil, err)
+	return
+}
+
+// Transfer records a transfer, failing with ErrNotSupported if the wrapped connection is not a Transferer
+func (c *recordConn) Transfer(msgs ...Msg) (err error) {
+	t, ok := c.conn.(Transferer)
+	if !ok {
+		return ErrNotSupported
+	}
+
+	err = t.Transfer(msgs...)
+	c.rec.record(recordedTx{Address: c.address, TenBit: c.tenBit, Msgs: transferMsgs(msgs, err == nil)}, nil, err)
+	return
+}
+
+// SMBus records an SMBus transaction, failing with ErrNotSupported if the wrapped connection is not an SMBusConn
+func (c *recordConn) SMBus(read bool, command byte, protocol SMBusProtocol, data []byte) (err error) {
+	s, ok := c.conn.(SMBusConn)
+	if !ok {
+		return ErrNotSupported
+	}
+
+	c.mu.Lock()
+	tx := recordedTx{Address: c.address, TenBit: c.tenBit, SMBus: &recordedSMBus{Read: read, Command: command, Protocol: protocol, PEC: c.pec}}
+	c.mu.Unlock()
+
+	tx.SMBus.Data = hex.EncodeToString(smbusWritten(read, protocol, data))
+	if err = s.SMBus(read, command, protocol, data); err == nil {
+		tx.SMBus.Result = hex.EncodeToString(smbusResult(read, protocol, data))
+	}
+
+	c.rec.record(tx, nil, err)
+	return
+}
+
+// SetPEC sets packet error checking on the wrapped connection, failing with ErrNotSupported if it is not an SMBusConn
+func (c *recordConn) SetPEC(on bool) (err error) {
+	s, ok := c.conn.(SMBusConn)
+	if !ok {
+		return ErrNotSupported
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err = s.SetPEC(on); err == nil {
+		c.pec = on
+	}
+
+	return
+}
+
+// Lock locks the wrapped connection if it is a sync.Locker, such as a device on a Bus
+func (c *recordConn) Lock() {
+	if l, ok := c.conn.(sync.Locker); ok {
+		l.Lock()
+	} else {
+		c.lock.Lock()
+	}
+}
+
+func (c *recordConn) TryLock() bool {
+	if l, ok := c.conn.(interface{ TryLock() bool }); ok {
+		return l.TryLock()
+	}
+
+	if l, ok := c.conn.(sync.Locker); ok {
+		l.Lock()
+		return true
+	}
+
+	return c.lock.TryLock()
+}
+
+// Unlock unlocks the wrapped connection
+func (c *recordConn) Unlock() {
+	if l, ok := c.conn.(sync.Locker); ok {
+		l.Unlock()
+	} else {
+		c.lock.Unlock()
+	}
+}
+
+func (c *recordConn) TenBit() bool {
+	return c.tenBit
+}
+
+func (c *recordConn) busNumber() int {
+	if b, ok := c.conn.(interface{ busNumber() int }); ok {
+		return b.busNumber()
+	}
+
+	return -1
+}
+
+func (c *recordConn) muxChannel() int {
+	if m, ok := c.conn.(interface{ muxChannel() int }); ok {
+		return m.muxChannel()
+	}
+
+	return -1
+}
+
+func (c *recordConn) tracer() Tracer {
+	if d, ok := c.conn.(tracerDefaults); ok {
+		return d.tracer()
+	}
+
+	return nil
+}
+
+func (c *recordConn) retryPolicy() *RetryPolicy {
+	if d, ok := c.conn.(retryDefaults); ok {
+		return d.retryPolicy()
+	}
+
+	return nil
+}
+
+func (c *recordConn) addRetries(n uint64) {
+	if d, ok := c.conn.(retryDefaults); ok {
+		d.addRetries(n)
+	}
+}
+
+func (c *recordConn) Close() {
+	c.conn.Close()
+}
+
+// Replay is a fake bus that replays a recorded session. Every transaction made
+// with the devices opened on it must match the next recorded transaction, in
+// order, or it fails with ErrReplayDivergence as do all further transactions.
+type Replay struct {
+	mu   sync.Mutex
+	txs  []recordedTx
+	next int
+	err  error
+}
+
+// NewReplay reads a session written by a Recorder
+func NewReplay(r io.Reader) (rp *Replay, err error) {
+	rp = &Replay{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		var tx recordedTx
+		if err = json.Unmarshal(scanner.Bytes(), &tx); err != nil {
+			err = fmt.Errorf("failed to read I2C recording line %d: %w", line, err)
+			return
+		}
+
+		rp.txs = append(rp.txs, tx)
+	}
+
+	err = scanner.Err()
+	return
+}
+
+// Open returns a connection to the device at a 7-bit address in the recording
+func (rp *Replay) Open(address uint16) Conn {
+	return &replayConn{replay: rp, address: address}
+}
+
+// Open10 returns a connection to the device at a 10-bit address in the recording
+func (rp *Replay) Open10(address uint16) Conn {
+	return &replayConn{replay: rp, address: address, tenBit: true}
+}
+
+// Err returns the divergence from the recording, if any
+func (rp *Replay) Err() error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	return rp.err
+}
+
+// Done checks that the whole recording was replayed without diverging
+func (rp *Replay) Done() error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.err != nil {
+		return rp.err
+	}
+
+	if rp.next < len(rp.txs) {
+		return fmt.Errorf("%w: %d of %d recorded transactions were not replayed", ErrReplayDivergence, len(rp.txs)-rp.next, len(rp.txs))
+	}
+
+	return nil
+}
+
+// describe formats a transaction for a divergence error
+func describe(tx recordedTx) string {
+	s := fmt.Sprintf("address 0x%02X", tx.Address)
+	if tx.TenBit {
+		s = fmt.Sprintf("10-bit address 0x%03X", tx.Address)
+	}
+	for _, m := range tx.Msgs {
+		if m.Read {
+			s += fmt.Sprintf(" read %d", m.Len)
+		} else {
+			s += fmt.Sprintf(" write [%s]", m.Data)
+		}
+	}
+
+	if b := tx.SMBus; b != nil {
+		if b.Read {
+			s += fmt.Sprintf(" smbus read command 0x%02X protocol %d", b.Command, b.Protocol)
+		} else {
+			s += fmt.Sprintf(" smbus write command 0x%02X protocol %d [%s]", b.Command, b.Protocol, b.Data)
+		}
+
+		if b.PEC {
+			s += " with PEC"
+		}
+	}
+
+	return s
+}
+
+// matches checks whether a recorded transaction is the same request as a transaction being replayed
+func (tx *recordedTx) matches(req recordedTx) bool {
+	if tx.Address != req.Address || tx.TenBit != req.TenBit || len(tx.Msgs) != len(req.Msgs) || (tx.SMBus == nil) != (req.SMBus == nil) {
+		return false
+	}
+
+	for i, m := range req.Msgs {
+		if tx.Msgs[i].Read != m.Read || tx.Msgs[i].Len != m.Len || (!m.Read && tx.Msgs[i].Data != m.Data) {
+			return false
+		}
+	}
+
+	if b := req.SMBus; b != nil {
+		r := tx.SMBus
+		return r.Read == b.Read && r.Command == b.Command && r.Protocol == b.Protocol && r.PEC == b.PEC && r.Data == b.Data
+	}
+
+	return true
+}
+
+// match matches a transaction to the next in the recording, returning the
+// recorded transaction or its recorded failure
+func (rp *Replay) match(req recordedTx, op string, reg int) (tx recordedTx, err error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.err != nil {
+		return tx, rp.err
+	}
+
+	if rp.next >= len(rp.txs) {
+		rp.err = fmt.Errorf("%w: unexpected transaction %d %s after the end of the recording", ErrReplayDivergence, rp.next+1, describe(req))
+		return tx, rp.err
+	}
+
+	if tx = rp.txs[rp.next]; !tx.matches(req) {
+		rp.err = fmt.Errorf("%w: transaction %d was %s rather than the recorded %s", ErrReplayDivergence, rp.next+1, describe(req), describe(tx))
+		return tx, rp.err
+	}
+
+	rp.next++
+
+	switch {
+	case tx.Errno != 0:
+		err = &I2CError{Op: op, Bus: -1, Address: req.Address, TenBit: req.TenBit, Reg: reg, Errno: syscall.Errno(tx.Errno)}
+	case tx.Err != "":
+		var kind error
+		for _, k := range recordedKinds {
+			if k.name == tx.Kind {
+				kind = k.err
+			}
+		}
+
+		err = &replayedError{msg: tx.Err, kind: kind}
+	}
+
+	return
+}
+
+// replay matches a transaction of I2C messages to the next in the recording,
+// returning the recorded data of each read message
+func (rp *Replay) replay(address uint16, tenBit bool, msgs []recordedMsg, op string, reg int) (reads [][]byte, err error) {
+	var tx recordedTx
+	if tx, err = rp.match(recordedTx{Address: address, TenBit: tenBit, Msgs: msgs}, op, reg); err != nil {
+		return
+	}
+
+	for _, m := range tx.Msgs {
+		if !m.Read {
+			continue
+		}
+
+		var read []byte
+		if read, err = hex.DecodeString(m.Data); err == nil && len(read) != m.Len {
+			err = fmt.Errorf("recorded I2C transaction to address 0x%02X read %d bytes rather than %d", address, len(read), m.Len)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		reads = append(reads, read)
+	}
+
+	return
+}
+
+// replayConn is a connection to a device in a Replay
+type replayConn struct {
+	replay  *Replay
+	address uint16
+	tenBit  bool
+	mu      sync.Mutex
+	pec     bool
+}
+
+func (c *replayConn) Address() uint16 {
+	return c.address
+}
+
+// TenBit reports whether the address of the device is a 10-bit address
+func (c *replayConn) TenBit() bool {
+	return c.tenBit
+}
+
+func (c *replayConn) ReadReg(reg byte, length int) (val []byte, err error) {
+	return c.read(wireMsgs(reg8Bytes(reg), nil, length), int(reg))
+}
+
+func (c *replayConn) ReadReg16(reg uint16, length int) (val []byte, err error) {
+	return c.read(wireMsgs(reg16Bytes(reg), nil, length), int(reg))
+}
+
+// read replays a register read returning the data of the read message
+func (c *replayConn) read(msgs []recordedMsg, reg int) (val []byte, err error) {
+	var reads [][]byte
+	if reads, err = c.replay.replay(c.address, c.tenBit, msgs, OpRead, reg); err != nil {
+		return
+	}
+
+	if len(reads) > 0 {
+		val = reads[0]
+	}
+
+	return
+}
+
+func (c *replayConn) Write(val []byte) (err error) {
+	_, err = c.replay.replay(c.address, c.tenBit, wireMsgs(nil, val, 0), OpWrite, -1)
+	return
+}
+
+func (c *replayConn) WriteReg(reg byte, val []byte) (err error) {
+	_, err = c.replay.replay(c.address, c.tenBit, wireMsgs(reg8Bytes(reg), val, 0), OpWrite, int(reg))
+	return
+}
+
+func (c *replayConn) WriteReg16(reg uint16, val []byte) (err error) {
+	_, err = c.replay.replay(c.address, c.tenBit, wireMsgs(reg16Bytes(reg), val, 0), OpWrite, int(reg))
+	return
+}
+
+func (c *replayConn) Transfer(msgs ...Msg) (err error) {
+	var reads [][]byte
+	if reads, err = c.replay.replay(c.address, c.tenBit, transferMsgs(msgs, false), OpTransfer, -1); err != nil {
+		return
+	}
+
+	for _, m := range msgs {
+		if m.Read {
+			copy(m.Data, reads[0])
+			reads = reads[1:]
+		}
+	}
+
+	return
+}
+
+// SMBus replays an SMBus transaction, filling in the recorded data read
+func (c *replayConn) SMBus(read bool, command byte, protocol SMBusProtocol, data []byte) (err error) {
+	c.mu.Lock()
+	req := recordedTx{Address: c.address, TenBit: c.tenBit, SMBus: &recordedSMBus{Read: read, Command: command, Protocol: protocol, PEC: c.pec}}
+	c.mu.Unlock()
+
+	op := OpSMBusWrite
+	if read {
+		op = OpSMBusRead
+	}
+
+	req.SMBus.Data = hex.EncodeToString(smbusWritten(read, protocol, data))
+
+	var tx recordedTx
+	if tx, err = c.replay.match(req, op, int(command)); err != nil {
+		return
+	}
+
+	var result []byte
+	if result, err = hex.DecodeString(tx.SMBus.Result); err != nil {
+		return
+	}
+
+	copy(data, result)
+	return
+}
+
+// SetPEC sets the packet error checking that the SMBus transactions must have been recorded with
+func (c *replayConn) SetPEC(on bool) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pec = on
+	return
+}
+
+func (c *replayConn) Close() {
+}
@@ -0,0 +1,245 @@
+package piicodev
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// recordENS160 records the initialisation and a reading of an ENS160 on a fake device
+func recordENS160(t *testing.T) []byte {
+	f := NewFakeConn()
+	f.SetReg(_REG_PART_ID, 0x60, 0x01)
+	f.SetReg(_REG_DEVICE_STATUS, 1<<_BIT_DEVICE_STATUS_NEWDAT, 2, 0x34, 0x12, 0x20, 0x03)
+
+	var session bytes.Buffer
+	rec := NewRecorder(&session)
+
+	s, err := NewENS160WithConn(rec.Wrap(f))
+	if err != nil {
+		t.Fatalf("Error while creating the ENS160: %v", err)
+	}
+
+	f.QueueError(&I2CError{Op: "read", Reg: _REG_DEVICE_STATUS, Errno: syscall.EREMOTEIO})
+	if _, err = s.ReadTVOC(); !errors.Is(err, ErrNoDevice) {
+		t.Fatalf("Expected the injected NAK but got %v", err)
+	}
+
+	if _, _, err = s.ReadECO2(); err != nil {
+		t.Fatalf("Error reading eCO2: %v", err)
+	}
+
+	if err = rec.Err(); err != nil {
+		t.Fatalf("Error recording the session: %v", err)
+	}
+
+	return session.Bytes()
+}
+
+func TestRecordReplay(t *testing.T) {
+	session := recordENS160(t)
+
+	rp, err := NewReplay(bytes.NewReader(session))
+	if err != nil {
+		t.Fatalf("Error reading the session: %v", err)
+	}
+
+	s, err := NewENS160WithConn(rp.Open(0))
+	if err != nil {
+		t.Fatalf("Error while creating the ENS160 from the replay: %v", err)
+	}
+
+	if _, err = s.ReadTVOC(); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("Expected the recorded NAK but got %v", err)
+	}
+
+	var eco2 uint16
+	if eco2, _, err = s.ReadECO2(); err != nil || eco2 != 800 {
+		t.Errorf("Replayed eCO2 is %d (%v) rather than 800", eco2, err)
+	}
+
+	if err = rp.Done(); err != nil {
+		t.Errorf("Replay did not complete: %v", err)
+	}
+}
+
+func TestReplayDivergence(t *testing.T) {
+	session := recordENS160(t)
+
+	rp, _ := NewReplay(bytes.NewReader(session))
+	i2c := NewI2C(rp.Open(0))
+
+	if _, err := i2c.ReadRegU16LE(_REG_PART_ID); err != nil {
+		t.Fatalf("Error replaying the first transaction: %v", err)
+	}
+
+	if err := i2c.WriteRegU8(_REG_OPMODE, _VAL_OPMODE_IDLE); !errors.Is(err, ErrReplayDivergence) {
+		t.Errorf("Diverging write returned %v", err)
+	}
+
+	if _, err := i2c.ReadRegU8(_REG_OPMODE); !errors.Is(err, ErrReplayDivergence) {
+		t.Errorf("Transaction after diverging returned %v", err)
+	}
+
+	if err := rp.Done(); !errors.Is(err, ErrReplayDivergence) {
+		t.Errorf("Diverged replay completed with %v", err)
+	}
+
+	rp, _ = NewReplay(bytes.NewReader(session))
+	if err := rp.Done(); !errors.Is(err, ErrReplayDivergence) {
+		t.Errorf("Replay with no transactions completed with %v", err)
+	}
+}
+
+func TestRecordReplayTransfer(t *testing.T) {
+	f := NewFakeConn()
+	f.SetReg(0x20, 0x01, 0x02, 0x03)
+
+	var session bytes.Buffer
+	rec := NewI2C(NewRecorder(&session).Wrap(f))
+
+	read := make([]byte, 3)
+	if err := rec.Transfer(Msg{Data: []byte{0x20}}, Msg{Read: true, Data: read}); err != nil {
+		t.Fatalf("Error recording a transfer: %v", err)
+	}
+
+	rp, _ := NewReplay(&session)
+	replayed := make([]byte, 3)
+	if err := NewI2C(rp.Open(0)).Transfer(Msg{Data: []byte{0x20}}, Msg{Read: true, Data: replayed}); err != nil || !bytes.Equal(replayed, read) {
+		t.Errorf("Replayed transfer read %X (%v) rather than %X", replayed, err, read)
+	}
+
+	if err := rp.Done(); err != nil {
+		t.Errorf("Replay did not complete: %v", err)
+	}
+}
+
+func TestRecordReplaySMBusAndErrors(t *testing.T) {
+	f := NewFakeConn()
+	f.SetReg(0x20, 0x42)
+
+	var session bytes.Buffer
+	rec := NewI2C(NewRecorder(&session).Wrap(f))
+
+	if err := rec.SetPEC(true); err != nil {
+		t.Fatalf("Error enabling PEC: %v", err)
+	}
+
+	if v, err := rec.SMBusReadByteData(0x20); err != nil || v != 0x42 {
+		t.Fatalf("Recorded SMBus byte 0x%X (%v) rather than 0x42", v, err)
+	}
+
+	if err := rec.SMBusWriteWordData(0x21, 0x1234); err != nil {
+		t.Fatalf("Error recording an SMBus write: %v", err)
+	}
+
+	if _, err := rec.ReadReg(0x22, 0); err != nil {
+		t.Fatalf("Error recording an empty read: %v", err)
+	}
+
+	f.QueueError(&TimeoutError{Device: "fake", Op: "read"})
+	if _, err := rec.ReadRegU8(0x20); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expected the injected timeout but got %v", err)
+	}
+
+	rp, err := NewReplay(bytes.NewReader(session.Bytes()))
+	if err != nil {
+		t.Fatalf("Error reading the session: %v", err)
+	}
+
+	replay := NewI2C(rp.Open(0))
+	if v, err := replay.SMBusReadByteData(0x20); !errors.Is(err, ErrReplayDivergence) {
+		t.Errorf("SMBus read without PEC returned 0x%X (%v)", v, err)
+	}
+
+	rp, _ = NewReplay(bytes.NewReader(session.Bytes()))
+	replay = NewI2C(rp.Open(0))
+	replay.SetPEC(true)
+
+	if v, err := replay.SMBusReadByteData(0x20); err != nil || v != 0x42 {
+		t.Errorf("Replayed SMBus byte 0x%X (%v) rather than 0x42", v, err)
+	}
+
+	if err = replay.SMBusWriteWordData(0x21, 0x1234); err != nil {
+		t.Errorf("Error replaying an SMBus write: %v", err)
+	}
+
+	if _, err = replay.ReadReg(0x22, 0); err != nil {
+		t.Errorf("Error replaying an empty read: %v", err)
+	}
+
+	var timeout *TimeoutError
+	if _, err = replay.ReadRegU8(0x20); !errors.Is(err, ErrTimeout) || errors.As(err, &timeout) || err.Error() != "timeout waiting for fake read to complete" {
+		t.Errorf("Replayed timeout is %v", err)
+	}
+
+	if err = rp.Done(); err != nil {
+		t.Errorf("Replay did not complete: %v", err)
+	}
+}
+
+func TestRecorderWrapsBusDevice(t *testing.T) {
+	b := &Bus{bus: 1, locks: make(map[uint16]*sync.Mutex), slave: -1}
+	b.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2})
+	b.SetTracer(TracerFunc(func(tx *Transaction) {}))
+
+	dev := b.Open(0x29)
+	dev.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3})
+
+	wrapped, ok := NewRecorder(&bytes.Buffer{}).Wrap(dev).(*I2C)
+	if !ok {
+		t.Fatalf("Recording a device on a bus did not return an *I2C")
+	}
+
+	if p := wrapped.RetryPolicy(); p == nil || p.MaxAttempts != 3 {
+		t.Errorf("Recorded device has the retry policy %+v", p)
+	}
+
+	rc := wrapped.Conn.(*recordConn)
+	if rc.Address() != 0x29 || rc.busNumber() != 1 || rc.tracer() == nil || rc.retryPolicy().MaxAttempts != 2 {
+		t.Errorf("Recorded connection does not forward the bus defaults")
+	}
+
+	wrapped.Lock()
+	if b.addressLock(slaveAddr{address: 0x29}).TryLock() {
+		t.Errorf("Locking the recorded device did not lock the address on the bus")
+	}
+	wrapped.Unlock()
+}
+
+// tenBitFake is a fake device at a 10-bit address
+type tenBitFake struct {
+	*FakeConn
+}
+
+func (f tenBitFake) Address() uint16 {
+	return 0x50
+}
+
+func (f tenBitFake) TenBit() bool {
+	return true
+}
+
+func TestRecordReplayTenBit(t *testing.T) {
+	f := NewFakeConn()
+	f.SetReg(0x10, 0x42)
+
+	var session bytes.Buffer
+	rec := NewI2C(NewRecorder(&session).Wrap(tenBitFake{f}))
+
+	if _, err := rec.ReadRegU8(0x10); err != nil {
+		t.Fatalf("Error recording a read: %v", err)
+	}
+
+	rp, _ := NewReplay(bytes.NewReader(session.Bytes()))
+	if _, err := NewI2C(rp.Open(0x50)).ReadRegU8(0x10); !errors.Is(err, ErrReplayDivergence) {
+		t.Errorf("Read at the 7-bit address replayed the 10-bit device: %v", err)
+	}
+
+	rp, _ = NewReplay(bytes.NewReader(session.Bytes()))
+	if v, err := NewI2C(rp.Open10(0x50)).ReadRegU8(0x10); err != nil || v != 0x42 {
+		t.Errorf("Replayed 0x%X (%v) at the 10-bit address rather than 0x42", v, err)
+	}
+}
@@ -0,0 +1,345 @@
+// Registry of drivers used to discover and instantiate the devices on a bus
+package piicodev
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Driver describes a device type so that it can be found and instantiated by Discover
+type Driver struct {
+	// Name of the device type
+	Name string
+
+	// Addresses the device can be found at by default
+	Addresses []uint8
+
+	// AnyAddress allows Probe to be called at any address, for devices with a
+	// configurable address and identity registers that are safe to read from
+	// any other device
+	AnyAddress bool
+
+	// Probe reads the identity registers of a device to check that it is this
+	// device type, returning the firmware version if known. Nil if the device
+	// has no identity registers and can only be recognised by its address.
+	Probe func(i2c *I2C) (firmware string, ok bool)
+
+	// New creates a ready-to-use instance of the driver on a connection
+	New func(conn Conn) (device interface{}, err error)
+}
+
+// hasAddress checks whether an address is one of the default addresses of the driver
+func (d *Driver) hasAddress(address uint8) bool {
+	for _, a := range d.Addresses {
+		if a == address {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readFirmware reads a major and minor firmware version from two registers
+func readFirmware(i2c *I2C, majorReg, minorReg byte) (firmware string) {
+	major, err := i2c.ReadRegU8(majorReg)
+	if err != nil {
+		return
+	}
+
+	minor, err := i2c.ReadRegU8(minorReg)
+	if err != nil {
+		return
+	}
+
+	firmware = fmt.Sprintf("%d.%d", major, minor)
+	return
+}
+
+var (
+	driversMu sync.Mutex
+
+	// drivers are probed in order with the most specific identity registers first.
+	// Devices which do not support 8-bit register addresses are only probed at their
+	// default addresses as the 16-bit register address would be written to other devices.
+	drivers = []Driver{
+		{
+			Name:       "Switch",
+			Addresses:  []uint8{SwitchAddress},
+			AnyAddress: true,
+			Probe: func(i2c *I2C) (firmware string, ok bool) {
+				if id, err := i2c.ReadRegU16BE(_SWITCH_REG_WHOAMI); err == nil && id == _DEVICE_ID_SWITCH {
+					firmware, ok = readFirmware(i2c, _SWITCH_REG_FIRM_MAJ, _SWITCH_REG_FIRM_MIN), true
+				}
+				return
+			},
+			New: func(conn Conn) (device interface{}, err error) { return NewSwitchWithConn(conn) },
+		},
+		{
+			Name:       "Potentiometer",
+			Addresses:  []uint8{PotentiometerAddress},
+			AnyAddress: true,
+			Probe: func(i2c *I2C) (firmware string, ok bool) {
+				if id, err := i2c.ReadRegU16BE(_POT_REG_WHOAMI); err == nil && (id == _DEVICE_ID_POT || id == _DEVICE_ID_SLIDE) {
+					firmware, ok = readFirmware(i2c, _POT_REG_FIRM_MAJ, _POT_REG_FIRM_MIN), true
+				}
+				return
+			},
+			New: func(conn Conn) (device interface{}, err error) { return NewPotentiometerWithConn(conn) },
+		},
+		{
+			Name:      "ENS160",
+			Addresses: []uint8{0x52, ENS160Address},
+			Probe: func(i2c *I2C) (firmware string, ok bool) {
+				id, err := i2c.ReadRegU16LE(_REG_PART_ID)
+				ok = err == nil && id == _VAL_PART_ID
+				return
+			},
+			New: func(conn Conn) (device interface{}, err error) { return NewENS160WithConn(conn) },
+		},
+		{
+			Name:      "TMP117",
+			Addresses: []uint8{TMP117Address, 0x49, 0x4A, 0x4B},
+			Probe: func(i2c *I2C) (firmware string, ok bool) {
+				id, err := i2c.ReadRegU16BE(_TMP117_REG_DEVICE_ID)
+				ok = err == nil && id&0x0FFF == _TMP117_DEVICE_ID
+				return
+			},
+			New: func(conn Conn) (device interface{}, err error) { return NewTMP117WithConn(conn) },
+		},
+		{
+			Name:      "VL53L1X",
+			Addresses: []uint8{VL53L1XAddress},
+			Probe: func(i2c *I2C) (firmware string, ok bool) {
+				id, err := i2c.ReadReg16U16BE(_VL53L1X_MODEL_ID_REG)
+				ok = err == nil && id == _VL53L1X_MODEL_ID
+				return
+			},
+			New: func(conn Conn) (device interface{}, err error) { return NewVL53L1XWithConn(conn) },
+		},
+		{
+			Name:      "CAP1203",
+			Addresses: []uint8{CAP1203Address},
+			Probe: func(i2c *I2C) (firmware string, ok bool) {
+				id, err := i2c.ReadRegU8(CAP1203ProdIDReg)
+				ok = err == nil && id == CAP1203ProdIDValue
+				return
+			},
+			New: func(conn Conn) (device interface{}, err error) { return NewCAP1203WithConn(conn) },
+		},
+		{
+			Name:      "MPU6050",
+			Addresses: []uint8{MPU6050Address, MPU6050Address + 1},
+			Probe: func(i2c *I2C) (firmware string, ok bool) {
+				id, err := i2c.ReadRegU8(WHO_AM_I)
+				ok = err == nil && id == WHO_AM_I_VALUE
+				return
+			},
+			New: func(conn Conn) (device interface{}, err error) { return NewMPU6050WithConn(conn) },
+		},
+		{
+			Name:       "Buzzer",
+			Addresses:  []uint8{BuzzerAddress},
+			AnyAddress: true,
+			Probe: func(i2c *I2C) (firmware string, ok bool) {
+				if id, err := i2c.ReadRegU8(BuzzerDeviceIDReg); err == nil && id == BuzzerDeviceID {
+					firmware, ok = readFirmware(i2c, BuzzerFirmwareVersionMajorReg, BuzzerFirmwareVersionMinorReg), true
+				}
+				return
+			},
+			New: func(conn Conn) (device interface{}, err error) { return NewBuzzerWithConn(conn) },
+		},
+		{
+			Name:       "QwiicPIR",
+			Addresses:  []uint8{QwiicPIRAddress, QwiicPIRAddress + 1},
+			AnyAddress: true,
+			Probe: func(i2c *I2C) (firmware string, ok bool) {
+				if id, err := i2c.ReadRegU8(QwiicPIRDeviceIDReg); err == nil && id == QwiicPIRDeviceID {
+					firmware, ok = readFirmware(i2c, QwiicPIRFirmwareVersionMajorReg, QwiicPIRFirmwareVersionMinorReg), true
+				}
+				return
+			},
+			New: func(conn Conn) (device interface{}, err error) { return NewQwiicPIRWithConn(conn) },
+		},
+		{
+			Name:      "MS5637",
+			Addresses: []uint8{MS5637Address},
+			New:       func(conn Conn) (device interface{}, err error) { return NewMS5637WithConn(conn) },
+		},
+		{
+			Name:      "VEML6030",
+			Addresses: []uint8{VEML6030Address, 0x48},
+			New:       func(conn Conn) (device interface{}, err error) { return NewVEML6030WithConn(conn) },
+		},
+		{
+			Name:      "VEML6040",
+			Addresses: []uint8{VEML6040Address},
+			New:       func(conn Conn) (device interface{}, err error) { return NewVEML6040WithConn(conn) },
+		},
+		{
+			Name:      "RGBLED",
+			Addresses: []uint8{RGBLEDAddress},
+			New:       func(conn Conn) (device interface{}, err error) { return NewRGBLEDWithConn(conn) },
+		},
+		{
+			Name:      "AHT10",
+			Addresses: []uint8{AHT10Address, 0x39},
+			New:       func(conn Conn) (device interface{}, err error) { return NewAHT10WithConn(conn) },
+		},
+		{
+			Name:      "LM75A",
+			Addresses: []uint8{0x48, 0x49, 0x4A, 0x4B, 0x4C, 0x4D, 0x4E, LM75AAddress},
+			New:       func(conn Conn) (device interface{}, err error) { return NewLM75AWithConn(conn) },
+		},
+	}
+)
+
+// RegisterDriver adds a driver to the registry used by Identify and Discover.
+// Drivers are probed in the order they were registered after the built-in drivers.
+func RegisterDriver(d Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	drivers = append(drivers, d)
+}
+
+// Drivers returns a copy of the registered drivers
+func Drivers() []Driver {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	return append([]Driver{}, drivers...)
+}
+
+// BusAddress is the location of a device on an I2C bus
+type BusAddress struct {
+	Bus     int
+	Address uint8
+}
+
+// DiscoveryStatus describes how a device found by Discover was resolved
+type DiscoveryStatus int
+
+const (
+	DiscoveryIdentified DiscoveryStatus = iota // the identity registers matched a driver
+	DiscoveryAssumed                           // the only driver with the address has no identity registers
+	DiscoveryAmbiguous                         // more than one driver without identity registers has the address
+	DiscoveryUnknown                           // no registered driver has the address
+	DiscoveryFailed                            // the driver failed to initialise the device
+)
+
+func (s DiscoveryStatus) String() string {
+	switch s {
+	case DiscoveryIdentified:
+		return "identified"
+	case DiscoveryAssumed:
+		return "assumed"
+	case DiscoveryAmbiguous:
+		return "ambiguous"
+	case DiscoveryUnknown:
+		return "unknown"
+	case DiscoveryFailed:
+		return "failed"
+	}
+
+	return fmt.Sprintf("DiscoveryStatus(%d)", int(s))
+}
+
+// Discovered is a device found by Discover
+type Discovered struct {
+	BusAddress
+	Status     DiscoveryStatus
+	Type       string      // the device type if identified or assumed
+	Firmware   string      // the firmware version if known
+	Candidates []string    // the possible device types when ambiguous
+	Device     interface{} // the driver instance (e.g. *TMP117), nil unless identified or assumed
+	Err        error       // the error from the driver when failed
+}
+
+func (d *Discovered) String() string {
+	switch d.Status {
+	case DiscoveryIdentified, DiscoveryAssumed:
+		return fmt.Sprintf("bus %d address 0x%02X: %s (%s)", d.Bus, d.Address, d.Type, d.Status)
+	case DiscoveryAmbiguous:
+		return fmt.Sprintf("bus %d address 0x%02X: %s, could be any of %v", d.Bus, d.Address, d.Status, d.Candidates)
+	case DiscoveryFailed:
+		return fmt.Sprintf("bus %d address 0x%02X: %s %s: %v", d.Bus, d.Address, d.Type, d.Status, d.Err)
+	}
+
+	return fmt.Sprintf("bus %d address 0x%02X: %s", d.Bus, d.Address, d.Status)
+}
+
+// resolve determines the driver for a device found by a 7-bit scan and creates an instance of it
+func resolve(conn Conn, bus int, r ScanResult) (d Discovered) {
+	var driver *Driver
+	registered := Drivers()
+	address := uint8(r.Address)
+
+	d.BusAddress = BusAddress{Bus: bus, Address: address}
+	d.Type, d.Firmware = r.Type, r.Firmware
+	if d.Type != "" {
+		d.Status = DiscoveryIdentified
+		for i := range registered {
+			if registered[i].Name == d.Type {
+				driver = &registered[i]
+				break
+			}
+		}
+	} else {
+		var candidates []Driver
+		for _, c := range registered {
+			if c.Probe == nil && c.hasAddress(address) {
+				candidates = append(candidates, c)
+				d.Candidates = append(d.Candidates, c.Name)
+			}
+		}
+
+		switch len(candidates) {
+		case 0:
+			d.Status = DiscoveryUnknown
+			return
+		case 1:
+			d.Status = DiscoveryAssumed
+			d.Type = candidates[0].Name
+			driver = &candidates[0]
+		default:
+			d.Status = DiscoveryAmbiguous
+			return
+		}
+	}
+
+	if driver == nil || driver.New == nil {
+		return
+	}
+
+	var err error
+	if d.Device, err = driver.New(conn); err != nil {
+		d.Status = DiscoveryFailed
+		d.Device = nil
+		d.Err = err
+		conn.Close()
+	}
+
+	return
+}
+
+// Discover scans each bus and creates a driver instance for every device that is
+// identified by its identity registers, or that is at an address used by only one
+// driver without identity registers. Unknown and ambiguous devices are reported
+// without an instance. The caller is responsible for closing the instances.
+func Discover(buses ...*Bus) (found map[BusAddress]*Discovered, err error) {
+	found = make(map[BusAddress]*Discovered)
+
+	for _, b := range buses {
+		var results []ScanResult
+		if results, err = b.Scan(); err != nil {
+			return
+		}
+
+		for _, r := range results {
+			d := resolve(b.Open(uint8(r.Address)), b.Number(), r)
+			found[d.BusAddress] = &d
+		}
+	}
+
+	return
+}
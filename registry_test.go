@@ -0,0 +1,67 @@
+package piicodev
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var errTest = errors.New("test error")
+
+// resolveFake identifies and resolves a fake device as Discover would for a scanned device
+func resolveFake(f *FakeConn, address uint8) Discovered {
+	r := ScanResult{Address: uint16(address)}
+	r.Type, r.Firmware = Identify(f, address)
+	return resolve(f, 1, r)
+}
+
+func TestDiscoverResolve(t *testing.T) {
+	tmp117 := NewFakeConn()
+	tmp117.SetReg(_TMP117_REG_DEVICE_ID, 0x01, 0x17)
+
+	d := resolveFake(tmp117, TMP117Address)
+	if _, ok := d.Device.(*TMP117); d.Status != DiscoveryIdentified || !ok {
+		t.Errorf("TMP117 resolved as %v with %T", d.Status, d.Device)
+	}
+
+	d = resolveFake(NewFakeConn(), 0x48)
+	if d.Status != DiscoveryAmbiguous || d.Device != nil || !reflect.DeepEqual(d.Candidates, []string{"VEML6030", "LM75A"}) {
+		t.Errorf("Unidentified device at 0x48 resolved as %s", d.String())
+	}
+
+	d = resolveFake(NewFakeConn(), MS5637Address)
+	if _, ok := d.Device.(*MS5637); d.Status != DiscoveryAssumed || !ok {
+		t.Errorf("MS5637 resolved as %s with %T", d.String(), d.Device)
+	}
+
+	d = resolveFake(NewFakeConn(), 0x20)
+	if d.Status != DiscoveryUnknown || d.Device != nil {
+		t.Errorf("Unknown device resolved as %s", d.String())
+	}
+
+	ens160 := NewFakeConn()
+	ens160.SetReg(_REG_PART_ID, 0x60, 0x01)
+
+	r := ScanResult{Address: ENS160Address}
+	r.Type, r.Firmware = Identify(ens160, ENS160Address)
+	ens160.QueueError(errTest)
+	d = resolve(ens160, 1, r)
+	if d.Status != DiscoveryFailed || d.Err != errTest || !ens160.IsClosed() {
+		t.Errorf("ENS160 failing to initialise resolved as %s", d.String())
+	}
+
+	RegisterDriver(Driver{
+		Name:      "Custom",
+		Addresses: []uint8{0x20},
+		Probe: func(i2c *I2C) (firmware string, ok bool) {
+			v, err := i2c.ReadRegU8(0x00)
+			return "", err == nil && v == 0xC5
+		},
+	})
+
+	custom := NewFakeConn()
+	custom.SetReg(0x00, 0xC5)
+	if d = resolveFake(custom, 0x20); d.Status != DiscoveryIdentified || d.Type != "Custom" {
+		t.Errorf("Registered driver resolved as %s", d.String())
+	}
+}
@@ -0,0 +1,562 @@
+// Using an I2C bus on another machine over TCP
+package piicodev
+
+// The remote I2C protocol is a sequence of request and response frames on a
+// stream connection, each prefixed with its length as a 32-bit big endian
+// integer that does not include the prefix. The client sends one request and
+// waits for its response before sending the next.
+//
+// A request is:
+//
+//	op      uint8   the operation
+//	flags   uint8   bit 0 is set for a 10-bit address
+//	address uint16  the device address
+//	body            the arguments of the operation
+//
+// A response is:
+//
+//	errno   uint32  0 for success or the errno of the failure
+//	body            the result of a successful operation
+//
+// Integers are big endian. The operations are:
+//
+//	0x00 hello      request: none (the address is ignored)
+//	                response: version uint8 (1), bus int32, functionality uint64
+//	0x01 read       request: reg uint8, length uint16; response: the bytes read
+//	0x02 read16     request: reg uint16, length uint16; response: the bytes read
+//	0x03 write      request: the bytes to write; response: none
+//	0x04 write reg  request: reg uint8, the bytes to write; response: none
+//	0x05 write16    request: reg uint16, the bytes to write; response: none
+//	0x06 transfer   request: count uint8, then for each message read uint8 (0 or 1),
+//	                length uint16 and for a write the bytes to write
+//	                response: the bytes read by the read messages in order
+//	0x07 smbus      request: read uint8 (0 or 1), command uint8, protocol uint8
+//	                and the 34 bytes of i2c_smbus_data; response: the 34 bytes
+//	0x08 set PEC    request: on uint8 (0 or 1); response: none
+//	0x09 lock       request: none; response: none if the client now holds the
+//	                lock of the address on the server's bus, or EAGAIN without
+//	                waiting if another client or local user holds it
+//	0x0A unlock     request: none; response: none
+//
+// A client must send hello first. Failures without an errno are reported as EIO,
+// and operations the server's connections do not support as EOPNOTSUPP. The
+// locks held by a client are released when its connection is closed.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	remoteVersion = 1
+
+	// remoteMaxFrame limits the size of a frame so a bad length is not allocated
+	remoteMaxFrame = 1 << 20
+
+	// remoteMaxRead is the most bytes read by a transfer, whose response frame
+	// also holds the errno
+	remoteMaxRead = remoteMaxFrame - 4
+
+	// The backoff between the attempts to take the lock of a device held by
+	// another client, doubling up to the maximum
+	remoteLockBackoff    = time.Millisecond
+	remoteLockMaxBackoff = 50 * time.Millisecond
+)
+
+// The operations of the remote I2C protocol
+const (
+	remoteHello      byte = 0x00
+	remoteRead       byte = 0x01
+	remoteRead16     byte = 0x02
+	remoteWrite      byte = 0x03
+	remoteWriteReg   byte = 0x04
+	remoteWriteReg16 byte = 0x05
+	remoteTransfer   byte = 0x06
+	remoteSMBus      byte = 0x07
+	remoteSetPEC     byte = 0x08
+	remoteLock       byte = 0x09
+	remoteUnlock     byte = 0x0A
+)
+
+// ErrRemoteProtocol is matched by errors for a malformed frame of the remote I2C protocol
+var ErrRemoteProtocol = errors.New("remote I2C protocol error")
+
+// writeFrame writes a frame with its length prefix
+func writeFrame(w *bufio.Writer, frame []byte) (err error) {
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], uint32(len(frame)))
+
+	if _, err = w.Write(prefix[:]); err != nil {
+		return
+	}
+
+	if _, err = w.Write(frame); err != nil {
+		return
+	}
+
+	return w.Flush()
+}
+
+// readFrame reads a frame after its length prefix
+func readFrame(r io.Reader) (frame []byte, err error) {
+	var prefix [4]byte
+	if _, err = io.ReadFull(r, prefix[:]); err != nil {
+		return
+	}
+
+	n := binary.BigEndian.Uint32(prefix[:])
+	if n > remoteMaxFrame {
+		err = fmt.Errorf("%w: frame of %d bytes", ErrRemoteProtocol, n)
+		return
+	}
+
+	frame = make([]byte, n)
+	_, err = io.ReadFull(r, frame)
+	return
+}
+
+// RemoteBus is a connection to an I2C bus exposed by a Server on another machine.
+// The devices opened on it can be passed to any of the NewXxxWithConn driver
+// constructors. Requests are made one at a time. Locking a device also takes
+// the lock of its address on the server, so that the multi-step sequences of a
+// driver are not interleaved with those of other clients or local users.
+type RemoteBus struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	w     *bufio.Writer
+	bus   int
+	funcs Functionality
+
+	mu      sync.Mutex    // serialises the requests
+	err     error         // the error that broke the connection
+	timeout time.Duration // the deadline of each request, or 0 for none
+	lmu     sync.Mutex
+	locks   map[uint16]*sync.Mutex
+}
+
+// DialBus connects to the Server of a remote I2C bus, for example
+// DialBus("tcp", "raspberrypi.local:7001")
+func DialBus(network, address string) (rb *RemoteBus, err error) {
+	var conn net.Conn
+	if conn, err = net.Dial(network, address); err != nil {
+		return
+	}
+
+	if rb, err = NewRemoteBus(conn); err != nil {
+		conn.Close()
+	}
+
+	return
+}
+
+// NewRemoteBus uses an already open connection to the Server of a remote I2C bus
+func NewRemoteBus(conn net.Conn) (rb *RemoteBus, err error) {
+	rb = &RemoteBus{
+		conn:  conn,
+		r:     bufio.NewReader(conn),
+		w:     bufio.NewWriter(conn),
+		locks: make(map[uint16]*sync.Mutex),
+	}
+
+	var data []byte
+	var errno syscall.Errno
+	if data, errno, err = rb.call(remoteHello, slaveAddr{}, nil); err != nil {
+		return nil, err
+	}
+
+	if errno != 0 || len(data) != 13 || data[0] != remoteVersion {
+		return nil, fmt.Errorf("%w: unexpected hello response %X (%v)", ErrRemoteProtocol, data, errno)
+	}
+
+	rb.bus = int(int32(binary.BigEndian.Uint32(data[1:])))
+	rb.funcs = Functionality(binary.BigEndian.Uint64(data[5:]))
+	return
+}
+
+// Number returns the bus number of the adapter on the remote machine
+func (rb *RemoteBus) Number() int {
+	return rb.bus
+}
+
+// Functionality returns what the adapter on the remote machine supports
+func (rb *RemoteBus) Functionality() Functionality {
+	return rb.funcs
+}
+
+// Open returns a handle to the device at an address on the remote bus. Closing
+// the handle does not close the remote bus.
+func (rb *RemoteBus) Open(address uint8) *I2C {
+	return NewI2C(&remoteConn{bus: rb, slaveAddr: slaveAddr{address: uint16(address)}})
+}
+
+// Open10 returns a handle to the device at a 10-bit address on the remote bus
+func (rb *RemoteBus) Open10(address uint16) *I2C {
+	return NewI2C(&remoteConn{bus: rb, slaveAddr: slaveAddr{address: address, tenBit: true}})
+}
+
+// SetTimeout sets how long to wait for the response to each request, or 0 (the
+// default) to wait indefinitely. A request that times out fails with an error
+// matching ErrTimeout and breaks the connection, as its response may still
+// arrive. Waiting for the lock of a device held by another client is also
+// limited to the timeout, failing the transactions made with the lock.
+func (rb *RemoteBus) SetTimeout(d time.Duration) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.timeout = d
+}
+
+// requestTimeout returns the timeout set with SetTimeout
+func (rb *RemoteBus) requestTimeout() time.Duration {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	return rb.timeout
+}
+
+// Close closes the connection to the server
+func (rb *RemoteBus) Close() {
+	rb.conn.Close()
+}
+
+// call makes a request and waits for its response. An error is returned if the
+// connection failed, after which every request fails with the same error.
+func (rb *RemoteBus) call(op byte, a slaveAddr, body []byte) (data []byte, errno syscall.Errno, err error) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	if rb.err != nil {
+		return nil, 0, rb.err
+	}
+
+	var flags byte
+	if a.tenBit {
+		flags = 1
+	}
+
+	if rb.timeout > 0 {
+		if err = rb.conn.SetDeadline(time.Now().Add(rb.timeout)); err == nil {
+			defer rb.conn.SetDeadline(time.Time{})
+		}
+	}
+
+	frame := append([]byte{op, flags, byte(a.address >> 8), byte(a.address)}, body...)
+	if err == nil {
+		err = writeFrame(rb.w, frame)
+	}
+
+	if err == nil {
+		frame, err = readFrame(rb.r)
+	}
+
+	if err == nil && len(frame) < 4 {
+		err = fmt.Errorf("%w: response of %d bytes", ErrRemoteProtocol, len(frame))
+	}
+
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		err = fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+
+	if err != nil {
+		rb.err = fmt.Errorf("remote I2C bus %s: %w", rb.conn.RemoteAddr(), err)
+		rb.conn.Close()
+		return nil, 0, rb.err
+	}
+
+	errno = syscall.Errno(binary.BigEndian.Uint32(frame))
+	data = frame[4:]
+	return
+}
+
+// addressLock returns the lock for multi-step sequences with the device at an address
+func (rb *RemoteBus) addressLock(a slaveAddr) *sync.Mutex {
+	rb.lmu.Lock()
+	defer rb.lmu.Unlock()
+
+	l, ok := rb.locks[a.key()]
+	if !ok {
+		l = new(sync.Mutex)
+		rb.locks[a.key()] = l
+	}
+
+	return l
+}
+
+// remoteConn is a device on a remote bus
+type remoteConn struct {
+	bus *RemoteBus
+	slaveAddr
+	mu      sync.Mutex
+	lockErr error // the failure to take the lock on the server, until unlocked
+}
+
+// request makes a request for the device, converting a failure into an I2CError
+func (c *remoteConn) request(op string, reg int, remoteOp byte, body []byte) (data []byte, err error) {
+	c.mu.Lock()
+	err = c.lockErr
+	c.mu.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	var errno syscall.Errno
+	if data, errno, err = c.bus.call(remoteOp, c.slaveAddr, body); err != nil {
+		return
+	}
+
+	if errno != 0 {
+		return nil, c.error(op, reg, errno)
+	}
+
+	return
+}
+
+func (c *remoteConn) error(op string, reg int, errno syscall.Errno) error {
+	return &I2CError{Op: op, Bus: c.bus.bus, Address: c.address, TenBit: c.tenBit, Reg: reg, Errno: errno}
+}
+
+// checkLength fails with an error matching ErrInvalidLength and EINVAL if n
+// bytes do not fit in the 16-bit length of a message, rather than truncating it
+func (c *remoteConn) checkLength(op string, reg int, n int) (err error) {
+	if n > maxMsgLen {
+		err = fmt.Errorf("%w (%d bytes): %w", ErrInvalidLength, n, c.error(op, reg, syscall.EINVAL))
+	}
+
+	return
+}
+
+// readInto makes a read request and copies the bytes read into buf
+func (c *remoteConn) readInto(reg int, remoteOp byte, body []byte, buf []byte) (err error) {
+	var data []byte
+	if data, err = c.request(OpRead, reg, remoteOp, body); err != nil {
+		return
+	}
+
+	if len(data) != len(buf) {
+		return fmt.Errorf("%w: read %d bytes rather than %d", ErrRemoteProtocol, len(data), len(buf))
+	}
+
+	copy(buf, data)
+	return
+}
+
+func (c *remoteConn) Address() uint16 {
+	return c.address
+}
+
+// TenBit reports whether the address of the device is a 10-bit address
+func (c *remoteConn) TenBit() bool {
+	return c.tenBit
+}
+
+// Functionality returns what the adapter on the remote machine supports
+func (c *remoteConn) Functionality() Functionality {
+	return c.bus.funcs
+}
+
+func (c *remoteConn) busNumber() int {
+	return c.bus.bus
+}
+
+func (c *remoteConn) ReadReg(reg byte, length int) (val []byte, err error) {
+	val = make([]byte, length)
+	err = c.ReadRegInto(reg, val)
+	return
+}
+
+func (c *remoteConn) ReadReg16(reg uint16, length int) (val []byte, err error) {
+	val = make([]byte, length)
+	err = c.ReadReg16Into(reg, val)
+	return
+}
+
+func (c *remoteConn) ReadRegInto(reg byte, buf []byte) (err error) {
+	if err = c.checkLength(OpRead, int(reg), len(buf)); err != nil {
+		return
+	}
+
+	return c.readInto(int(reg), remoteRead, []byte{reg, byte(len(buf) >> 8), byte(len(buf))}, buf)
+}
+
+func (c *remoteConn) ReadReg16Into(reg uint16, buf []byte) (err error) {
+	if err = c.checkLength(OpRead, int(reg), len(buf)); err != nil {
+		return
+	}
+
+	return c.readInto(int(reg), remoteRead16, []byte{byte(reg >> 8), byte(reg), byte(len(buf) >> 8), byte(len(buf))}, buf)
+}
+
+func (c *remoteConn) Write(val []byte) (err error) {
+	if err = c.checkLength(OpWrite, -1, len(val)); err != nil {
+		return
+	}
+
+	_, err = c.request(OpWrite, -1, remoteWrite, val)
+	return
+}
+
+func (c *remoteConn) WriteReg(reg byte, val []byte) (err error) {
+	if err = c.checkLength(OpWrite, int(reg), 1+len(val)); err != nil {
+		return
+	}
+
+	_, err = c.request(OpWrite, int(reg), remoteWriteReg, append([]byte{reg}, val...))
+	return
+}
+
+func (c *remoteConn) WriteReg16(reg uint16, val []byte) (err error) {
+	if err = c.checkLength(OpWrite, int(reg), 2+len(val)); err != nil {
+		return
+	}
+
+	_, err = c.request(OpWrite, int(reg), remoteWriteReg16, append([]byte{byte(reg >> 8), byte(reg)}, val...))
+	return
+}
+
+// Transfer makes a combined transaction of up to 255 messages with the remote device
+func (c *remoteConn) Transfer(msgs ...Msg) (err error) {
+	if len(msgs) > 0xFF {
+		return fmt.Errorf("%w (%d messages): %w", ErrInvalidLength, len(msgs), c.error(OpTransfer, -1, syscall.EINVAL))
+	}
+
+	body := []byte{byte(len(msgs))}
+	readLen := 0
+	for _, m := range msgs {
+		if err = c.checkLength(OpTransfer, -1, len(m.Data)); err != nil {
+			return
+		}
+
+		if m.Read {
+			if readLen += len(m.Data); readLen > remoteMaxRead {
+				return fmt.Errorf("%w (%d bytes read): %w", ErrInvalidLength, readLen, c.error(OpTransfer, -1, syscall.EINVAL))
+			}
+
+			body = append(body, 1, byte(len(m.Data)>>8), byte(len(m.Data)))
+		} else {
+			body = append(body, 0, byte(len(m.Data)>>8), byte(len(m.Data)))
+			body = append(body, m.Data...)
+		}
+	}
+
+	var data []byte
+	if data, err = c.request(OpTransfer, -1, remoteTransfer, body); err != nil {
+		return
+	}
+
+	if len(data) != readLen {
+		return fmt.Errorf("%w: transfer read %d bytes rather than %d", ErrRemoteProtocol, len(data), readLen)
+	}
+
+	for _, m := range msgs {
+		if m.Read {
+			data = data[copy(m.Data, data):]
+		}
+	}
+
+	return
+}
+
+// SMBus makes an SMBus transaction with the remote device
+func (c *remoteConn) SMBus(read bool, command byte, protocol SMBusProtocol, data []byte) (err error) {
+	op, body := OpSMBusWrite, []byte{0, command, byte(protocol)}
+	if read {
+		op, body[0] = OpSMBusRead, 1
+	}
+
+	var buf i2c_smbus_data
+	copy(buf[:], data)
+
+	var result []byte
+	if result, err = c.request(op, int(command), remoteSMBus, append(body, buf[:]...)); err != nil {
+		return
+	}
+
+	if len(result) != len(buf) {
+		return fmt.Errorf("%w: SMBus data of %d bytes", ErrRemoteProtocol, len(result))
+	}
+
+	copy(data, result)
+	return
+}
+
+// SetPEC sets packet error checking for the SMBus transactions of the remote device
+func (c *remoteConn) SetPEC(on bool) (err error) {
+	body := []byte{0}
+	if on {
+		body[0] = 1
+	}
+
+	_, err = c.request("enable PEC for", -1, remoteSetPEC, body)
+	return
+}
+
+// Lock takes the lock of the address on the client and then on the server,
+// trying again with a backoff while another client holds it. If the lock cannot
+// be taken on the server, the transactions made until Unlock fail with the error.
+func (c *remoteConn) Lock() {
+	c.bus.addressLock(c.slaveAddr).Lock()
+
+	timeout := c.bus.requestTimeout()
+	backoff := remoteLockBackoff
+	start := time.Now()
+
+	var err error
+	for {
+		if _, err = c.request("lock", -1, remoteLock, nil); !errors.Is(err, syscall.EAGAIN) {
+			break
+		}
+
+		if timeout > 0 && time.Since(start) >= timeout {
+			err = fmt.Errorf("%w for the lock: %w", ErrTimeout, err)
+			break
+		}
+
+		time.Sleep(backoff)
+		backoff = min(2*backoff, remoteLockMaxBackoff)
+	}
+
+	c.mu.Lock()
+	c.lockErr = err
+	c.mu.Unlock()
+}
+
+// TryLock takes the lock of the address on the client and then on the server if
+// neither is held
+func (c *remoteConn) TryLock() bool {
+	l := c.bus.addressLock(c.slaveAddr)
+	if !l.TryLock() {
+		return false
+	}
+
+	if _, err := c.request("lock", -1, remoteLock, nil); err != nil {
+		l.Unlock()
+		return false
+	}
+
+	return true
+}
+
+func (c *remoteConn) Unlock() {
+	c.mu.Lock()
+	locked := c.lockErr == nil
+	c.lockErr = nil
+	c.mu.Unlock()
+
+	if locked {
+		c.request("unlock", -1, remoteUnlock, nil)
+	}
+
+	c.bus.addressLock(c.slaveAddr).Unlock()
+}
+
+func (c *remoteConn) Close() {
+}
@@ -0,0 +1,266 @@
+package piicodev
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// startRemote serves fake devices on a loopback listener and connects a client to them
+func startRemote(t *testing.T, devices map[uint16]*FakeConn) *RemoteBus {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+
+	s := &Server{
+		Bus:           1,
+		Functionality: FuncI2C | FuncSMBusReadByteData,
+		Open: func(address uint16, tenBit bool) Conn {
+			if f, ok := devices[address]; ok && !tenBit {
+				return f
+			}
+
+			return NewFakeConn()
+		},
+	}
+
+	done := make(chan error)
+	go func() { done <- s.Serve(l) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Server returned %v", err)
+		}
+	})
+
+	rb, err := DialBus("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting to the server: %v", err)
+	}
+	t.Cleanup(rb.Close)
+
+	return rb
+}
+
+func TestRemoteBus(t *testing.T) {
+	vl53l1x := NewFakeConn()
+	vl53l1x.SetReg16(0x010F, 0xEA, 0xCC)
+	vl53l1x.SetReg16(0x0022, 0x01, 0x02)
+
+	rb := startRemote(t, map[uint16]*FakeConn{VL53L1XAddress: vl53l1x})
+	if rb.Number() != 1 || rb.Functionality() != FuncI2C|FuncSMBusReadByteData {
+		t.Errorf("Remote bus %d has functionality %v", rb.Number(), rb.Functionality())
+	}
+
+	i2c := rb.Open(VL53L1XAddress)
+	clock := NewFakeClock(time.Now())
+	clock.SetAutoAdvance(true)
+	i2c.SetClock(clock)
+
+	d, err := NewVL53L1XWithConn(i2c)
+	if err != nil {
+		t.Fatalf("Error creating the remote VL53L1X: %v", err)
+	}
+
+	if writes := vl53l1x.Writes(); len(writes) != 4 || !bytes.Equal(writes[3], []byte{0x00, 0x1E, 0x04, 0x08}) {
+		t.Errorf("Remote VL53L1X initialisation made the writes %X", writes)
+	}
+
+	vl53l1x.SetReg16(0x0089+13, 0x01, 0x2C)
+	if rng, err := d.Read(); err != nil || rng != 300 {
+		t.Errorf("Remote VL53L1X range is %d (%v) rather than 300", rng, err)
+	}
+
+	vl53l1x.QueueError(&I2CError{Op: "read", Reg: 0x10, Errno: syscall.EREMOTEIO})
+	var e *I2CError
+	if _, err = i2c.ReadRegU8(0x10); !errors.Is(err, ErrNoDevice) || !errors.As(err, &e) || e.Bus != 1 || e.Address != VL53L1XAddress {
+		t.Errorf("Remote NAK returned %v", err)
+	}
+
+	buf := make([]byte, 2)
+	if err = i2c.Transfer(Msg{Data: []byte{0x10, 0xAA, 0xBB}}, Msg{Data: []byte{0x10}}, Msg{Read: true, Data: buf}); err != nil || !bytes.Equal(buf, []byte{0xAA, 0xBB}) {
+		t.Errorf("Remote transfer read %X (%v)", buf, err)
+	}
+
+	if err = i2c.SMBusWriteByteData(0x20, 0x42); err != nil {
+		t.Errorf("Error writing a remote SMBus byte: %v", err)
+	}
+
+	if v, err := i2c.SMBusReadByteData(0x20); err != nil || v != 0x42 {
+		t.Errorf("Remote SMBus byte is 0x%X (%v)", v, err)
+	}
+
+	if err = i2c.SetPEC(true); err != nil || !vl53l1x.PEC() {
+		t.Errorf("Error enabling remote PEC: %v", err)
+	}
+
+	if f, err := i2c.Functionality(); err != nil || f != rb.Functionality() {
+		t.Errorf("Remote device functionality is %v (%v)", f, err)
+	}
+}
+
+func TestRemoteProtocol(t *testing.T) {
+	client, server := net.Pipe()
+	s := &Server{Open: func(address uint16, tenBit bool) Conn { return nopConn{} }}
+	go s.ServeConn(server)
+	defer client.Close()
+
+	r := bufio.NewReader(client)
+	w := bufio.NewWriter(client)
+
+	// a transfer reading more than fits in a response frame
+	oversized := []byte{remoteTransfer, 0, 0, 0x29, 17}
+	for i := 0; i < 17; i++ {
+		oversized = append(oversized, 1, 0xFF, 0xFF)
+	}
+
+	for _, tc := range []struct {
+		request  []byte
+		response []byte
+	}{
+		{[]byte{remoteHello, 0, 0, 0}, []byte{0, 0, 0, 0, remoteVersion, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{[]byte{remoteRead, 0, 0, 0x29, 0x10, 0x00, 0x02}, []byte{0, 0, 0, 0, 0, 0}},
+		{[]byte{remoteWriteReg16, 0, 0, 0x29, 0x00, 0x1E, 0x04}, []byte{0, 0, 0, 0}},
+		{[]byte{remoteRead, 0, 0, 0x80, 0x10, 0x00, 0x02}, []byte{0, 0, 0, byte(syscall.EINVAL)}},
+		{[]byte{remoteRead, 0, 0, 0x29, 0x10}, []byte{0, 0, 0, byte(syscall.EINVAL)}},
+		{[]byte{remoteTransfer, 0, 0, 0x29, 1, 0, 0, 2, 0x01}, []byte{0, 0, 0, byte(syscall.EINVAL)}},
+		{oversized, []byte{0, 0, 0, byte(syscall.EINVAL)}},
+		{[]byte{remoteSetPEC, 0, 0, 0x29, 1}, []byte{0, 0, 0, byte(syscall.EOPNOTSUPP)}},
+		{[]byte{remoteUnlock, 0, 0, 0x29}, []byte{0, 0, 0, byte(syscall.EINVAL)}},
+		{[]byte{remoteLock, 0, 0, 0x29}, []byte{0, 0, 0, 0}},
+		{[]byte{remoteLock, 0, 0, 0x29}, []byte{0, 0, 0, byte(syscall.EDEADLK)}},
+		{[]byte{remoteUnlock, 0, 0, 0x29}, []byte{0, 0, 0, 0}},
+		{[]byte{0xFF, 0, 0, 0x29}, []byte{0, 0, 0, byte(syscall.EINVAL)}},
+	} {
+		if err := writeFrame(w, tc.request); err != nil {
+			t.Fatalf("Error writing a request: %v", err)
+		}
+
+		response, err := readFrame(r)
+		if err != nil {
+			t.Fatalf("Error reading a response: %v", err)
+		}
+
+		if !bytes.Equal(response, tc.response) {
+			t.Errorf("Response to %X was %X rather than %X", tc.request, response, tc.response)
+		}
+	}
+
+	if _, err := readFrame(bytes.NewReader([]byte{0xFF, 0xFF, 0xFF, 0xFF})); !errors.Is(err, ErrRemoteProtocol) {
+		t.Errorf("Oversized frame returned %v", err)
+	}
+}
+
+func TestRemoteLock(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+
+	device := NewI2C(NewFakeConn())
+	s := &Server{Open: func(address uint16, tenBit bool) Conn { return device }}
+	go s.Serve(l)
+	defer s.Close()
+
+	rb1, err := DialBus("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting the first client: %v", err)
+	}
+	defer rb1.Close()
+
+	rb2, err := DialBus("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting the second client: %v", err)
+	}
+	defer rb2.Close()
+
+	rb1.Open(0x29).Lock()
+
+	// the lock of the first client is not waited for beyond the timeout
+	rb2.SetTimeout(50 * time.Millisecond)
+	d := rb2.Open(0x29)
+	d.Lock()
+	if _, err = d.ReadRegU8(0x10); !errors.Is(err, ErrTimeout) || !errors.Is(err, syscall.EAGAIN) {
+		t.Errorf("Read with a lock held by another client returned %v", err)
+	}
+	d.Unlock()
+
+	if _, err = d.ReadRegU8(0x10); err != nil {
+		t.Errorf("Read after a failed lock returned %v", err)
+	}
+	rb2.SetTimeout(0)
+
+	locked := make(chan struct{})
+	go func() {
+		d := rb2.Open(0x29)
+		d.Lock()
+		close(locked)
+		d.Unlock()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatalf("Second client locked a device locked by the first")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	rb1.Close()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Errorf("Lock of the first client was not released when it disconnected")
+	}
+}
+
+func TestRemoteLimits(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		r, w := bufio.NewReader(server), bufio.NewWriter(server)
+		if _, err := readFrame(r); err == nil {
+			writeFrame(w, []byte{0, 0, 0, 0, remoteVersion, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0})
+		}
+
+		// never respond to a request
+		io.Copy(io.Discard, r)
+	}()
+	defer server.Close()
+
+	rb, err := NewRemoteBus(client)
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	defer rb.Close()
+
+	i2c := rb.Open(0x29)
+	if _, err = i2c.ReadReg(0x10, 0x10000); !errors.Is(err, ErrInvalidLength) || !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("Read of 0x10000 bytes returned %v", err)
+	}
+
+	if err = i2c.Transfer(make([]Msg, 256)...); !errors.Is(err, ErrInvalidLength) || !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("Transfer of 256 messages returned %v", err)
+	}
+
+	msgs := make([]Msg, 17)
+	for i := range msgs {
+		msgs[i] = Msg{Read: true, Data: make([]byte, 0xFFFF)}
+	}
+
+	if err = i2c.Transfer(msgs...); !errors.Is(err, ErrInvalidLength) || !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("Transfer reading %d bytes returned %v", 17*0xFFFF, err)
+	}
+
+	rb.SetTimeout(20 * time.Millisecond)
+	if _, err = i2c.ReadRegU8(0x10); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Request without a response returned %v", err)
+	}
+
+	if err = i2c.WriteRegU8(0x10, 0x01); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Request after a timeout returned %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+// Retrying failed I2C transactions
+package piicodev
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// DefaultRetryableErrnos are the errnos retried when a RetryPolicy does not list any.
+// They are the errors seen from a NAK or a disturbed bus rather than a misuse of the bus.
+var DefaultRetryableErrnos = []syscall.Errno{
+	syscall.EREMOTEIO, syscall.ENXIO, syscall.EIO, syscall.ETIMEDOUT, syscall.EAGAIN,
+}
+
+// RetryPolicy describes how failed transactions are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first, so 1 or less disables retries
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry, doubled for each further retry
+	Backoff time.Duration
+
+	// MaxBackoff limits the delay between retries, or 0 for no limit
+	MaxBackoff time.Duration
+
+	// Retryable lists the errnos to retry, or nil for DefaultRetryableErrnos
+	Retryable []syscall.Errno
+
+	// RetryWrites also retries writes, transfers and SMBus writes and process calls.
+	// Only reads are retried by default, as a write that failed with an ambiguous
+	// error such as EIO or ETIMEDOUT may have reached the device, and repeating a
+	// write that is not idempotent, such as a FIFO push, a command or an address
+	// change, would apply it twice.
+	RetryWrites bool
+}
+
+// isRetryable checks whether an error has an errno that the policy retries
+func (p *RetryPolicy) isRetryable(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = DefaultRetryableErrnos
+	}
+
+	for _, e := range retryable {
+		if e == errno {
+			return true
+		}
+	}
+
+	return false
+}
+
+// run calls op until it succeeds, fails with an error that is not retryable or
+// the attempts are exhausted, returning the number of retries made. It returns
+// the error of the context if the context is done while waiting to retry.
+func (p *RetryPolicy) run(ctx context.Context, clock Clock, op func() error) (retries uint64, err error) {
+	backoff := p.Backoff
+
+	for attempt := 1; ; attempt++ {
+		if err = op(); err == nil || attempt >= p.MaxAttempts || !p.isRetryable(err) {
+			return
+		}
+
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+
+		select {
+		case <-clock.After(backoff):
+		case <-ctx.Done():
+			return retries, ctx.Err()
+		}
+
+		retries++
+		backoff *= 2
+	}
+}
+
+// retryDefaults is implemented by connections with a default retry policy and a
+// retry count shared with other connections, such as the devices on a Bus
+type retryDefaults interface {
+	retryPolicy() *RetryPolicy
+	addRetries(n uint64)
+}
+
+// SetRetryPolicy sets the retry policy for the device, overriding the policy of the
+// Bus it was opened on. Nil uses the policy of the Bus, if any, or disables retries.
+func (i2c *I2C) SetRetryPolicy(p *RetryPolicy) {
+	i2c = i2c.device()
+	i2c.cfgMu.Lock()
+	defer i2c.cfgMu.Unlock()
+
+	i2c.retry = p
+}
+
+// RetryPolicy returns the retry policy applied to the device or nil if there are no retries
+func (i2c *I2C) RetryPolicy() (p *RetryPolicy) {
+	i2c = i2c.device()
+	i2c.cfgMu.Lock()
+	p = i2c.retry
+	i2c.cfgMu.Unlock()
+
+	if p == nil {
+		if d, ok := i2c.Conn.(retryDefaults); ok {
+			p = d.retryPolicy()
+		}
+	}
+
+	return
+}
+
+// Retries returns the number of retries made for the device
+func (i2c *I2C) Retries() uint64 {
+	i2c = i2c.device()
+	return atomic.LoadUint64(&i2c.retries)
+}
+
+// withRetry runs a transaction with the retry policy of the device, only
+// retrying a write if the policy retries writes, and stopping the backoff if the
+// context of a handle from withContext is done
+func (i2c *I2C) withRetry(write bool, op func() error) (err error) {
+	p := i2c.RetryPolicy()
+	if p == nil || (write && !p.RetryWrites) {
+		return op()
+	}
+
+	ctx := i2c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var retries uint64
+	if retries, err = p.run(ctx, i2c.Clock(), op); retries > 0 {
+		atomic.AddUint64(&i2c.device().retries, retries)
+		if d, ok := i2c.Conn.(retryDefaults); ok {
+			d.addRetries(retries)
+		}
+	}
+
+	return
+}
+
+// SetRetryPolicy sets the default retry policy for all the devices opened on the bus
+func (b *Bus) SetRetryPolicy(p *RetryPolicy) {
+	b.cfgMu.Lock()
+	defer b.cfgMu.Unlock()
+
+	b.retry = p
+}
+
+// Retries returns the number of retries made for all the devices opened on the bus
+func (b *Bus) Retries() uint64 {
+	return atomic.LoadUint64(&b.retries)
+}
+
+func (d *devConn) retryPolicy() *RetryPolicy {
+	d.bus.cfgMu.Lock()
+	defer d.bus.cfgMu.Unlock()
+
+	return d.bus.retry
+}
+
+func (d *devConn) addRetries(n uint64) {
+	atomic.AddUint64(&d.bus.retries, n)
+}
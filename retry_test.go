@@ -0,0 +1,84 @@
+package piicodev
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	f := NewFakeConn()
+	f.SetReg(0x10, 0x42)
+
+	i2c := NewI2C(f)
+	nak := &I2CError{Op: "read", Bus: 1, Address: 0x10, Reg: 0x10, Errno: syscall.EREMOTEIO}
+
+	f.QueueError(nak)
+	if _, err := i2c.ReadRegU8(0x10); err != nak {
+		t.Errorf("Read without a retry policy returned %v rather than the NAK", err)
+	}
+
+	i2c.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3})
+
+	f.QueueError(nak)
+	f.QueueError(nak)
+	if v, err := i2c.ReadRegU8(0x10); err != nil || v != 0x42 {
+		t.Errorf("Read after two NAKs returned 0x%X (%v)", v, err)
+	}
+
+	if n := i2c.Retries(); n != 2 {
+		t.Errorf("Made %d retries rather than 2", n)
+	}
+
+	f.QueueError(nak)
+	if err := i2c.WriteRegU8(0x10, 0x01); !errors.Is(err, ErrNoDevice) || i2c.Retries() != 2 {
+		t.Errorf("Write with a policy that does not retry writes returned %v after %d retries", err, i2c.Retries())
+	}
+
+	i2c.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, RetryWrites: true})
+
+	f.QueueError(nak)
+	f.QueueError(nak)
+	f.QueueError(nak)
+	if err := i2c.WriteRegU8(0x10, 0x01); !errors.Is(err, ErrNoDevice) {
+		t.Errorf("Write after exhausting retries returned %v", err)
+	}
+
+	if n := i2c.Retries(); n != 4 {
+		t.Errorf("Made %d retries rather than 4", n)
+	}
+
+	f.QueueError(&I2CError{Op: "write", Bus: 1, Address: 0x10, Reg: -1, Errno: syscall.EINVAL})
+	if err := i2c.Write([]byte{0x01}); !errors.Is(err, syscall.EINVAL) || i2c.Retries() != 4 {
+		t.Errorf("Error that is not retryable returned %v after %d retries", err, i2c.Retries())
+	}
+
+	i2c.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, Retryable: []syscall.Errno{syscall.EINVAL}, RetryWrites: true})
+	f.QueueError(&I2CError{Op: "write", Bus: 1, Address: 0x10, Reg: -1, Errno: syscall.EINVAL})
+	if err := i2c.Write([]byte{0x01}); err != nil || i2c.Retries() != 5 {
+		t.Errorf("Listed retryable errno returned %v after %d retries", err, i2c.Retries())
+	}
+}
+
+func TestRetryMaxBackoff(t *testing.T) {
+	start := time.Now()
+	clock := NewFakeClock(start)
+	clock.SetAutoAdvance(true)
+
+	f := NewFakeConn()
+	i2c := NewI2C(f)
+	i2c.SetClock(clock)
+	i2c.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, Backoff: 5 * time.Second, MaxBackoff: time.Second})
+
+	nak := &I2CError{Op: "read", Bus: 1, Address: 0x10, Reg: 0x10, Errno: syscall.EREMOTEIO}
+	f.QueueError(nak)
+	f.QueueError(nak)
+	if _, err := i2c.ReadRegU8(0x10); err != nil {
+		t.Errorf("Read after two NAKs returned %v", err)
+	}
+
+	if d := clock.Now().Sub(start); d != 2*time.Second {
+		t.Errorf("Retries backed off for %v rather than 2s", d)
+	}
+}
@@ -20,11 +20,18 @@ type RGBLED struct {
 
 // NewRGBLED creates a new RGB LED instances
 func NewRGBLED(addr uint8, bus int) (l *RGBLED, err error) {
-	l = &RGBLED{leds: make([]byte, 9, 9)}
-	if l.i2c, err = OpenI2C(addr, bus); err != nil {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
 		return
 	}
 
+	return NewRGBLEDWithConn(i2c)
+}
+
+// NewRGBLEDWithConn creates a new RGBLED instance on an already open connection
+func NewRGBLEDWithConn(conn Conn) (l *RGBLED, err error) {
+	l = &RGBLED{i2c: NewI2C(conn), leds: make([]byte, 9, 9)}
+
 	l.Clear()
 	err = l.Show()
 	return
@@ -0,0 +1,130 @@
+// Scanning an I2C bus and identifying the devices found on it
+package piicodev
+
+import (
+	"syscall"
+	"time"
+)
+
+const (
+	// The range of 7-bit addresses probed by a scan (excludes reserved addresses)
+	ScanFirstAddress = 0x08
+	ScanLastAddress  = 0x77
+)
+
+// ScanResult is a device that responded to a probe during a scan
+type ScanResult struct {
+	Address  uint16
+	TenBit   bool   // the address is a 10-bit address
+	Type     string // the identified device type or empty if unknown
+	Firmware string // the firmware version as major.minor or empty if not available
+	Driver   string // the kernel driver bound to the address or empty if none
+}
+
+// Identify reads the identity registers of the device on a connection at an address
+// to determine the device type and firmware version. Only the registered drivers
+// with a Probe function are checked. The type is empty if unknown.
+func Identify(conn Conn, address uint8) (deviceType string, firmware string) {
+	i2c := NewI2C(conn)
+
+	for _, d := range Drivers() {
+		if d.Probe == nil || !(d.AnyAddress || d.hasAddress(address)) {
+			continue
+		}
+
+		if fw, ok := d.Probe(i2c); ok {
+			deviceType = d.Name
+			firmware = fw
+			return
+		}
+	}
+
+	return
+}
+
+// probe checks for a device at an address with a single byte read, using an
+// SMBus receive byte if the adapter does not support plain I2C messages
+func (b *Bus) probe(a slaveAddr) (found bool, err error) {
+	var buf [1]byte
+	var errno syscall.Errno
+
+	start := time.Now()
+	if !b.funcs.Has(FuncI2C) && b.funcs.Has(FuncSMBusReadByte) {
+		var data i2c_smbus_data
+		errno = b.smbus(a, false, I2C_SMBUS_READ, 0, uint32(SMBusByte), &data)
+		buf[0] = data[0]
+	} else {
+		errno = b.rdwr([]i2c_msg{newMsg(a.address, a.msgFlags()|I2C_M_RD, buf[:])})
+	}
+
+	if t := b.Tracer(); t != nil {
+		tx := Transaction{Bus: b.bus, Channel: -1, Address: a.address, TenBit: a.tenBit, Op: OpProbe, Reg: -1, Duration: time.Since(start), Errno: errno}
+		if errno == 0 {
+			tx.Data = buf[:]
+		} else {
+			tx.Err = errno
+		}
+		t.Trace(&tx)
+	}
+
+	switch errno {
+	case 0, syscall.EBUSY:
+		found = true
+	case syscall.ENXIO, syscall.EREMOTEIO, syscall.EIO, syscall.ETIMEDOUT:
+		found = false
+	default:
+		err = &I2CError{Op: OpProbe, Bus: b.bus, Address: a.address, TenBit: a.tenBit, Reg: -1, Errno: errno}
+	}
+
+	return
+}
+
+// Scan probes every 7-bit address on the bus and identifies the devices that respond
+func (b *Bus) Scan() (results []ScanResult, err error) {
+	for address := uint8(ScanFirstAddress); address <= ScanLastAddress; address++ {
+		var found bool
+		if found, err = b.probe(slaveAddr{address: uint16(address)}); err != nil {
+			return
+		}
+
+		if !found {
+			continue
+		}
+
+		r := ScanResult{Address: uint16(address)}
+		r.Driver, _ = KernelDriver(b.bus, address)
+		r.Type, r.Firmware = Identify(b.Open(address), address)
+		results = append(results, r)
+	}
+
+	return
+}
+
+// ScanTenBit probes every 10-bit address on the bus. The devices found are not
+// identified, as the registered drivers are all for 7-bit addresses. Fails with
+// ErrNotSupported if the adapter does not support Func10BitAddr.
+func (b *Bus) ScanTenBit() (results []ScanResult, err error) {
+	if !b.funcs.Has(Func10BitAddr) {
+		err = &BusError{Op: "scan the 10-bit addresses of", Bus: b.bus, Errno: syscall.EOPNOTSUPP}
+		return
+	}
+
+	for address := uint16(0); address <= 0x3FF; address++ {
+		a := slaveAddr{address: address, tenBit: true}
+
+		var found bool
+		if found, err = b.probe(a); err != nil {
+			return
+		}
+
+		if !found {
+			continue
+		}
+
+		r := ScanResult{Address: address, TenBit: true}
+		r.Driver, _ = kernelDriver(b.bus, a)
+		results = append(results, r)
+	}
+
+	return
+}
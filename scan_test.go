@@ -0,0 +1,48 @@
+package piicodev
+
+import (
+	"testing"
+)
+
+func TestIdentify(t *testing.T) {
+	sw := NewFakeConn()
+	sw.QueueReadReg(_SWITCH_REG_WHOAMI, []byte{0x01, 0x99}, []byte{0x01, 0x99})
+	sw.SetReg(_SWITCH_REG_FIRM_MAJ, 1, 2)
+
+	pir := NewFakeConn()
+	pir.SetReg(QwiicPIRDeviceIDReg, QwiicPIRDeviceID, 2, 1)
+
+	tof := NewFakeConn()
+	tof.SetReg16(_VL53L1X_MODEL_ID_REG, 0xEA, 0xCC)
+
+	mpu := NewFakeConn()
+	mpu.SetReg(WHO_AM_I, WHO_AM_I_VALUE)
+
+	for _, tc := range []struct {
+		conn       *FakeConn
+		address    uint8
+		deviceType string
+		firmware   string
+	}{
+		{sw, SwitchAddress, "Switch", "1.2"},
+		{sw, 0x50, "Switch", "1.2"},
+		{pir, QwiicPIRAddress, "QwiicPIR", "2.1"},
+		{tof, VL53L1XAddress, "VL53L1X", ""},
+		{tof, 0x30, "", ""},
+		{mpu, MPU6050Address + 1, "MPU6050", ""},
+		{NewFakeConn(), TMP117Address, "", ""},
+	} {
+		deviceType, firmware := Identify(tc.conn, tc.address)
+		if deviceType != tc.deviceType || firmware != tc.firmware {
+			t.Errorf("Device at 0x%X identified as %q %q rather than %q %q", tc.address, deviceType, firmware, tc.deviceType, tc.firmware)
+		}
+	}
+
+	tof.ClearLog()
+	Identify(tof, 0x30)
+	for _, tx := range tof.Log() {
+		if len(tx.Write) > 1 {
+			t.Errorf("A 16-bit register address %X was written to a device at an unknown address", tx.Write)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+// Exposing a local I2C bus to other machines over TCP
+package piicodev
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+)
+
+// Opener opens the connection to the device at a 7-bit or 10-bit address for a Server
+type Opener func(address uint16, tenBit bool) Conn
+
+// Server exposes an I2C bus to RemoteBus clients with the remote I2C protocol
+// described in remote.go. Each client has its own handles to the devices, so the
+// PEC setting of a device is per client, and its transactions are serialised with
+// those of other clients and local users by the bus. A client locking a device
+// holds the lock of its address on the bus until it unlocks it or disconnects.
+type Server struct {
+	Bus           int           // the bus number reported to clients
+	Functionality Functionality // the functionality reported to clients
+	Open          Opener        // opens the devices requested by clients
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+}
+
+// NewServer creates a server exposing the devices on a bus
+func NewServer(b *Bus) *Server {
+	return &Server{
+		Bus:           b.bus,
+		Functionality: b.funcs,
+		Open: func(address uint16, tenBit bool) Conn {
+			if tenBit {
+				return b.Open10(address)
+			}
+
+			return b.Open(uint8(address))
+		},
+	}
+}
+
+// ListenAndServe listens on a TCP address, such as ":7001", and serves clients
+// until the server is closed
+func (s *Server) ListenAndServe(address string) (err error) {
+	var l net.Listener
+	if l, err = net.Listen("tcp", address); err != nil {
+		return
+	}
+
+	return s.Serve(l)
+}
+
+// Serve serves the clients connecting to a listener until the server is closed,
+// when it returns nil, or accepting fails. The listener is closed on return.
+func (s *Server) Serve(l net.Listener) (err error) {
+	if !s.track(l, nil) {
+		l.Close()
+		return
+	}
+	defer s.untrack(l, nil)
+
+	for {
+		var c net.Conn
+		if c, err = l.Accept(); err != nil {
+			if s.isClosed() {
+				err = nil
+			}
+
+			return
+		}
+
+		go s.ServeConn(c)
+	}
+}
+
+// serverClient is the state of a client connection to a Server
+type serverClient struct {
+	devices map[uint16]*I2C     // the handles to the devices used by the client
+	locked  map[uint16]struct{} // the devices locked by the client
+}
+
+// ServeConn serves a single client connection until it is closed
+func (s *Server) ServeConn(c net.Conn) {
+	if !s.track(nil, c) {
+		c.Close()
+		return
+	}
+	defer s.untrack(nil, c)
+
+	client := &serverClient{devices: make(map[uint16]*I2C), locked: make(map[uint16]struct{})}
+	defer func() {
+		for key := range client.locked {
+			client.devices[key].Unlock()
+		}
+
+		for _, d := range client.devices {
+			d.Close()
+		}
+	}()
+
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			return
+		}
+
+		if err = writeFrame(w, s.handle(client, frame)); err != nil {
+			return
+		}
+	}
+}
+
+// Close stops the server, closing its listeners and client connections
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// track records an active listener or connection, failing if the server is closed
+func (s *Server) track(l net.Listener, c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+		s.conns = make(map[net.Conn]struct{})
+	}
+
+	if l != nil {
+		s.listeners[l] = struct{}{}
+	}
+
+	if c != nil {
+		s.conns[c] = struct{}{}
+	}
+
+	return true
+}
+
+// untrack closes and forgets a listener or connection
+func (s *Server) untrack(l net.Listener, c net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if l != nil {
+		l.Close()
+		delete(s.listeners, l)
+	}
+
+	if c != nil {
+		c.Close()
+		delete(s.conns, c)
+	}
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// handle makes the transaction of a request and returns the response
+func (s *Server) handle(client *serverClient, frame []byte) (response []byte) {
+	data, errno := s.request(client, frame)
+
+	response = make([]byte, 4, 4+len(data))
+	binary.BigEndian.PutUint32(response, uint32(errno))
+	return append(response, data...)
+}
+
+// request makes the transaction of a request, returning the response body or the errno of a failure
+func (s *Server) request(client *serverClient, frame []byte) (data []byte, errno syscall.Errno) {
+	if len(frame) < 4 {
+		return nil, syscall.EINVAL
+	}
+
+	op, body := frame[0], frame[4:]
+	a := slaveAddr{address: binary.BigEndian.Uint16(frame[2:]), tenBit: frame[1]&1 != 0}
+
+	if op == remoteHello {
+		data = []byte{remoteVersion, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(data[1:], uint32(int32(s.Bus)))
+		binary.BigEndian.PutUint64(data[5:], uint64(s.Functionality))
+		return
+	}
+
+	if (!a.tenBit && a.address > 0x7F) || a.address > 0x3FF {
+		return nil, syscall.EINVAL
+	}
+
+	i2c, ok := client.devices[a.key()]
+	if !ok {
+		i2c = NewI2C(s.Open(a.address, a.tenBit))
+		client.devices[a.key()] = i2c
+	}
+
+	_, locked := client.locked[a.key()]
+
+	var err error
+	switch {
+	case op == remoteRead && len(body) == 3:
+		data = make([]byte, binary.BigEndian.Uint16(body[1:]))
+		err = i2c.ReadRegInto(body[0], data)
+	case op == remoteRead16 && len(body) == 4:
+		data = make([]byte, binary.BigEndian.Uint16(body[2:]))
+		err = i2c.ReadReg16Into(binary.BigEndian.Uint16(body), data)
+	case op == remoteWrite:
+		err = i2c.Write(body)
+	case op == remoteWriteReg && len(body) >= 1:
+		err = i2c.WriteReg(body[0], body[1:])
+	case op == remoteWriteReg16 && len(body) >= 2:
+		err = i2c.WriteReg16(binary.BigEndian.Uint16(body), body[2:])
+	case op == remoteTransfer && len(body) >= 1:
+		var msgs []Msg
+		if msgs, ok = parseTransfer(body); !ok {
+			return nil, syscall.EINVAL
+		}
+
+		if err = i2c.Transfer(msgs...); err == nil {
+			for _, m := range msgs {
+				if m.Read {
+					data = append(data, m.Data...)
+				}
+			}
+		}
+	case op == remoteSMBus && len(body) == 3+len(i2c_smbus_data{}):
+		var buf i2c_smbus_data
+		copy(buf[:], body[3:])
+		if err = i2c.smbus(body[0] != 0, body[1], SMBusProtocol(body[2]), &buf); err == nil {
+			data = buf[:]
+		}
+	case op == remoteSetPEC && len(body) == 1:
+		err = i2c.SetPEC(body[0] != 0)
+	case op == remoteLock && len(body) == 0:
+		if locked {
+			return nil, syscall.EDEADLK
+		}
+
+		if !i2c.TryLock() {
+			return nil, syscall.EAGAIN
+		}
+
+		client.locked[a.key()] = struct{}{}
+	case op == remoteUnlock && len(body) == 0 && locked:
+		i2c.Unlock()
+		delete(client.locked, a.key())
+	default:
+		return nil, syscall.EINVAL
+	}
+
+	if err != nil {
+		return nil, remoteErrno(err)
+	}
+
+	return
+}
+
+// parseTransfer parses the messages of a transfer request
+func parseTransfer(body []byte) (msgs []Msg, ok bool) {
+	n := int(body[0])
+	body = body[1:]
+
+	readLen := 0
+	for i := 0; i < n; i++ {
+		if len(body) < 3 {
+			return
+		}
+
+		m := Msg{Read: body[0] != 0, Data: make([]byte, binary.BigEndian.Uint16(body[1:]))}
+		body = body[3:]
+
+		// the data read must fit in the response frame
+		if m.Read {
+			if readLen += len(m.Data); readLen > remoteMaxRead {
+				return
+			}
+		}
+
+		if !m.Read {
+			if len(body) < len(m.Data) {
+				return
+			}
+
+			body = body[copy(m.Data, body):]
+		}
+
+		msgs = append(msgs, m)
+	}
+
+	return msgs, len(body) == 0
+}
+
+// remoteErrno returns the errno reported to a client for an error
+func remoteErrno(err error) (errno syscall.Errno) {
+	if errors.As(err, &errno) && errno != 0 {
+		return
+	}
+
+	if errors.Is(err, ErrNotSupported) {
+		return syscall.EOPNOTSUPP
+	}
+
+	return syscall.EIO
+}
@@ -0,0 +1,230 @@
+// SMBus transactions through the Linux I2C_SMBUS ioctl
+package piicodev
+
+import (
+	"encoding/binary"
+	"fmt"
+	"syscall"
+)
+
+// SMBusProtocol is the size argument of the I2C_SMBUS ioctl selecting the SMBus protocol
+type SMBusProtocol uint32
+
+const (
+	SMBusQuick         SMBusProtocol = 0
+	SMBusByte          SMBusProtocol = 1
+	SMBusByteData      SMBusProtocol = 2
+	SMBusWordData      SMBusProtocol = 3
+	SMBusProcCall      SMBusProtocol = 4
+	SMBusBlockData     SMBusProtocol = 5
+	SMBusBlockProcCall SMBusProtocol = 7
+	SMBusI2CBlockData  SMBusProtocol = 8
+)
+
+// SMBusConn is implemented by connections that can make SMBus transactions
+type SMBusConn interface {
+	// SMBus makes a transaction of an SMBus protocol. The data is the union
+	// i2c_smbus_data of the kernel: the byte or little endian word in the first
+	// bytes, or a block with its length in the first byte followed by up to 32
+	// bytes. It is read into for reads and process calls.
+	SMBus(read bool, command byte, protocol SMBusProtocol, data []byte) (err error)
+
+	// SetPEC enables or disables packet error checking of the SMBus transactions
+	SetPEC(on bool) (err error)
+}
+
+// SetPEC enables or disables SMBus packet error checking for the device. With PEC
+// a transaction with a corrupted packet fails with an error matching ErrChecksum.
+func (i2c *I2C) SetPEC(on bool) (err error) {
+	s, ok := i2c.Conn.(SMBusConn)
+	if !ok {
+		return ErrNotSupported
+	}
+
+	return s.SetPEC(on)
+}
+
+// smbus makes an SMBus transaction with the retry policy and tracer
+func (i2c *I2C) smbus(read bool, command byte, protocol SMBusProtocol, data *i2c_smbus_data) (err error) {
+	s, ok := i2c.Conn.(SMBusConn)
+	if !ok {
+		return ErrNotSupported
+	}
+
+	op, write := OpSMBusWrite, data[:smbusDataLen(protocol, data)]
+	if read {
+		op, write = OpSMBusRead, nil
+	}
+
+	_, err = i2c.transact(op, int(command), write, func() ([]byte, error) {
+		if err := s.SMBus(read, command, protocol, data[:]); err != nil {
+			return nil, err
+		}
+
+		if read || protocol == SMBusProcCall || protocol == SMBusBlockProcCall {
+			return data[:smbusDataLen(protocol, data)], nil
+		}
+
+		return nil, nil
+	})
+
+	return
+}
+
+// smbusDataLen returns the number of bytes of the data used by a protocol
+func smbusDataLen(protocol SMBusProtocol, data *i2c_smbus_data) int {
+	switch protocol {
+	case SMBusByte, SMBusByteData:
+		return 1
+	case SMBusWordData, SMBusProcCall:
+		return 2
+	case SMBusBlockData, SMBusBlockProcCall, SMBusI2CBlockData:
+		if n := int(data[0]); n <= I2C_SMBUS_BLOCK_MAX {
+			return n + 1
+		}
+		return len(data)
+	}
+
+	return 0
+}
+
+// SMBusQuick sends a quick command, which is only the read/write bit
+func (i2c *I2C) SMBusQuick(read bool) (err error) {
+	var data i2c_smbus_data
+	err = i2c.smbus(read, 0, SMBusQuick, &data)
+	return
+}
+
+// SMBusReadByte receives a byte without a command
+func (i2c *I2C) SMBusReadByte() (val byte, err error) {
+	var data i2c_smbus_data
+	if err = i2c.smbus(true, 0, SMBusByte, &data); err != nil {
+		return
+	}
+
+	val = data[0]
+	return
+}
+
+// SMBusWriteByte sends a byte without a command
+func (i2c *I2C) SMBusWriteByte(val byte) (err error) {
+	var data i2c_smbus_data
+	err = i2c.smbus(false, val, SMBusByte, &data)
+	return
+}
+
+// SMBusReadByteData reads a byte from a command
+func (i2c *I2C) SMBusReadByteData(command byte) (val byte, err error) {
+	var data i2c_smbus_data
+	if err = i2c.smbus(true, command, SMBusByteData, &data); err != nil {
+		return
+	}
+
+	val = data[0]
+	return
+}
+
+// SMBusWriteByteData writes a byte to a command
+func (i2c *I2C) SMBusWriteByteData(command byte, val byte) (err error) {
+	var data i2c_smbus_data
+	data[0] = val
+	err = i2c.smbus(false, command, SMBusByteData, &data)
+	return
+}
+
+// SMBusReadWordData reads a little endian word from a command
+func (i2c *I2C) SMBusReadWordData(command byte) (val uint16, err error) {
+	var data i2c_smbus_data
+	if err = i2c.smbus(true, command, SMBusWordData, &data); err != nil {
+		return
+	}
+
+	val = binary.LittleEndian.Uint16(data[:2])
+	return
+}
+
+// SMBusWriteWordData writes a little endian word to a command
+func (i2c *I2C) SMBusWriteWordData(command byte, val uint16) (err error) {
+	var data i2c_smbus_data
+	binary.LittleEndian.PutUint16(data[:2], val)
+	err = i2c.smbus(false, command, SMBusWordData, &data)
+	return
+}
+
+// SMBusProcessCall writes a word to a command and reads the word the device returns
+func (i2c *I2C) SMBusProcessCall(command byte, val uint16) (result uint16, err error) {
+	var data i2c_smbus_data
+	binary.LittleEndian.PutUint16(data[:2], val)
+	if err = i2c.smbus(false, command, SMBusProcCall, &data); err != nil {
+		return
+	}
+
+	result = binary.LittleEndian.Uint16(data[:2])
+	return
+}
+
+// SMBusReadBlockData reads a block of up to 32 bytes from a command, where the
+// device sends the length of the block
+func (i2c *I2C) SMBusReadBlockData(command byte) (val []byte, err error) {
+	var data i2c_smbus_data
+	if err = i2c.smbus(true, command, SMBusBlockData, &data); err != nil {
+		return
+	}
+
+	n := int(data[0])
+	if n > I2C_SMBUS_BLOCK_MAX {
+		err = fmt.Errorf("%w: SMBus block of %d bytes is longer than %d", ErrInvalidLength, n, I2C_SMBUS_BLOCK_MAX)
+		return
+	}
+
+	val = append([]byte{}, data[1:n+1]...)
+	return
+}
+
+// SMBusWriteBlockData writes a block of up to 32 bytes to a command, sending the length of the block
+func (i2c *I2C) SMBusWriteBlockData(command byte, val []byte) (err error) {
+	if len(val) > I2C_SMBUS_BLOCK_MAX {
+		return fmt.Errorf("%w: SMBus block of %d bytes is longer than %d", ErrInvalidLength, len(val), I2C_SMBUS_BLOCK_MAX)
+	}
+
+	var data i2c_smbus_data
+	data[0] = byte(len(val))
+	copy(data[1:], val)
+	err = i2c.smbus(false, command, SMBusBlockData, &data)
+	return
+}
+
+// SMBus uses the I2C_SMBUS ioctl call to make an SMBus transaction
+func (d *devConn) SMBus(read bool, command byte, protocol SMBusProtocol, data []byte) (err error) {
+	var buf i2c_smbus_data
+	copy(buf[:], data)
+
+	op, readWrite := OpSMBusWrite, I2C_SMBUS_WRITE
+	if read {
+		op, readWrite = OpSMBusRead, I2C_SMBUS_READ
+	}
+
+	d.bufMu.Lock()
+	pec := d.pec
+	d.bufMu.Unlock()
+
+	if errno := d.bus.smbus(d.slaveAddr, pec, readWrite, command, uint32(protocol), &buf); errno != 0 {
+		return d.error(op, int(command), errno)
+	}
+
+	copy(data, buf[:])
+	return
+}
+
+// SetPEC sets packet error checking for the SMBus transactions of the device
+func (d *devConn) SetPEC(on bool) (err error) {
+	if on && !d.bus.funcs.Has(FuncSMBusPEC) {
+		return d.error("enable PEC for", -1, syscall.EOPNOTSUPP)
+	}
+
+	d.bufMu.Lock()
+	defer d.bufMu.Unlock()
+
+	d.pec = on
+	return
+}
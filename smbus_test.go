@@ -0,0 +1,114 @@
+package piicodev
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestSMBus(t *testing.T) {
+	f := NewFakeConn()
+	i2c := NewI2C(f)
+
+	if err := i2c.SMBusWriteByteData(0x01, 0xAB); err != nil {
+		t.Fatalf("Error writing a byte: %v", err)
+	}
+
+	if v, err := i2c.SMBusReadByteData(0x01); err != nil || v != 0xAB {
+		t.Errorf("Read byte 0x%X (%v) rather than 0xAB", v, err)
+	}
+
+	if err := i2c.SMBusWriteWordData(0x02, 0x1234); err != nil || !bytes.Equal(f.Reg(0x02, 2), []byte{0x34, 0x12}) {
+		t.Errorf("Word was written as %X (%v) rather than little endian", f.Reg(0x02, 2), err)
+	}
+
+	if v, err := i2c.SMBusReadWordData(0x02); err != nil || v != 0x1234 {
+		t.Errorf("Read word 0x%X (%v) rather than 0x1234", v, err)
+	}
+
+	if v, err := i2c.SMBusProcessCall(0x04, 0x5678); err != nil || v != 0x5678 {
+		t.Errorf("Process call returned 0x%X (%v) rather than 0x5678", v, err)
+	}
+
+	if err := i2c.SMBusWriteBlockData(0x10, []byte{1, 2, 3}); err != nil {
+		t.Fatalf("Error writing a block: %v", err)
+	}
+
+	if v, err := i2c.SMBusReadBlockData(0x10); err != nil || !bytes.Equal(v, []byte{1, 2, 3}) {
+		t.Errorf("Read block %X (%v) rather than 010203", v, err)
+	}
+
+	if err := i2c.SMBusWriteBlockData(0x10, make([]byte, 33)); !errors.Is(err, ErrInvalidLength) {
+		t.Errorf("Block longer than 32 bytes returned %v", err)
+	}
+
+	if err := i2c.SMBusWriteByte(0x01); err != nil {
+		t.Fatalf("Error sending a byte: %v", err)
+	}
+
+	if v, err := i2c.SMBusReadByte(); err != nil || v != 0xAB {
+		t.Errorf("Received byte 0x%X (%v) rather than 0xAB", v, err)
+	}
+
+	if err := i2c.SMBusQuick(false); err != nil {
+		t.Errorf("Error sending a quick command: %v", err)
+	}
+
+	if err := i2c.SetPEC(true); err != nil || !f.PEC() {
+		t.Errorf("PEC was not enabled (%v)", err)
+	}
+
+	f.QueueError(&I2CError{Op: "smbus read", Bus: 1, Address: 0x0B, Reg: 0x01, Errno: syscall.EBADMSG})
+	if _, err := i2c.SMBusReadByteData(0x01); !errors.Is(err, ErrChecksum) {
+		t.Errorf("PEC failure returned %v", err)
+	}
+
+	if _, err := NewI2C(struct{ Conn }{f}).SMBusReadByteData(0x01); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("SMBus on a connection without SMBus returned %v", err)
+	}
+}
+
+// TestSMBusIoctl makes SMBus transactions with a file that is not an adapter,
+// which fails with ENOTTY when the address is set
+func TestSMBusIoctl(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "i2c")
+	if err != nil {
+		t.Fatalf("Error creating a file: %v", err)
+	}
+
+	b := &Bus{dev: f, locks: make(map[uint16]*sync.Mutex), slave: -1, funcs: ^Functionality(0)}
+	defer b.Close()
+
+	i2c := b.Open(0x0B)
+	if _, err = i2c.SMBusReadWordData(0x09); !errors.Is(err, syscall.ENOTTY) {
+		t.Errorf("SMBus read with a file returned %v rather than ENOTTY", err)
+	}
+
+	if b.slave != -1 {
+		t.Errorf("Address 0x%X recorded as set after failing", b.slave)
+	}
+}
+
+func TestSMBusForcedAddress(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "i2c")
+	if err != nil {
+		t.Fatalf("Error creating a file: %v", err)
+	}
+
+	smbusHook = func(i2c_smbus_ioctl_data) syscall.Errno { return 0 }
+	defer func() { smbusHook = nil }()
+
+	b := &Bus{dev: f, locks: make(map[uint16]*sync.Mutex), slave: 0x29, force: true, funcs: ^Functionality(0)}
+	defer b.Close()
+
+	if _, err = b.OpenForce(0x29).SMBusReadByteData(0x01); err != nil {
+		t.Errorf("SMBus read at the address set with I2C_SLAVE_FORCE returned %v", err)
+	}
+
+	if _, err = b.Open(0x29).SMBusReadByteData(0x01); !errors.Is(err, syscall.ENOTTY) {
+		t.Errorf("SMBus read without forcing the address set with I2C_SLAVE_FORCE returned %v rather than setting it with I2C_SLAVE", err)
+	}
+}
@@ -1,8 +1,6 @@
 // Core Electronics PiicoDev Switch
 package piicodev
 
-import "fmt"
-
 type Switch struct {
 	i2c *I2C
 }
@@ -27,19 +25,25 @@ const (
 )
 
 func NewSwitch(addr uint8, bus int) (s *Switch, err error) {
-	s = new(Switch)
-
-	if s.i2c, err = OpenI2C(addr, bus); err != nil {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
 		return
 	}
 
+	return NewSwitchWithConn(i2c)
+}
+
+// NewSwitchWithConn creates a new Switch instance on an already open connection
+func NewSwitchWithConn(conn Conn) (s *Switch, err error) {
+	s = &Switch{i2c: NewI2C(conn)}
+
 	var switchID uint16
 	if switchID, err = s.i2c.ReadRegU16BE(_SWITCH_REG_WHOAMI); err != nil {
 		return
 	}
 
 	if switchID != _DEVICE_ID_SWITCH {
-		err = fmt.Errorf("the switch ID is %d rather than %d", switchID, _SWITCH_REG_WHOAMI)
+		err = &DeviceIDError{Device: "Switch", ID: switchID, Expected: []uint16{_DEVICE_ID_SWITCH}}
 		return
 	}
 
@@ -157,6 +161,19 @@ func (s *Switch) SetDebounceEMAParameters(parameter uint8, period uint8) (err er
 	return
 }
 
+// SetAddress changes the I2C address of the switch to an address from 0x08 to
+// 0x77, moves the handle to the new address and checks that the switch answers there
+func (s *Switch) SetAddress(address uint8) (err error) {
+	s.i2c, err = changeAddress(s.i2c, "Switch", address,
+		func() error { return s.i2c.WriteRegU8(_SWITCH_REG_I2C_ADDRESS|(1<<7), address) },
+		func(i2c *I2C) bool {
+			id, err := i2c.ReadRegU16BE(_SWITCH_REG_WHOAMI)
+			return err == nil && id == _DEVICE_ID_SWITCH
+		})
+
+	return
+}
+
 // Close closes the handle to the device
 func (s *Switch) Close() {
 	s.i2c.Close()
@@ -0,0 +1,388 @@
+// TCA9548A 8-channel I2C multiplexer
+// https://www.ti.com/lit/ds/symlink/tca9548a.pdf
+package piicodev
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	TCA9548AAddress = 0x70
+
+	// TCA9548AChannels is the number of downstream channels of the multiplexer
+	TCA9548AChannels = 8
+)
+
+// ErrInvalidChannel is matched by errors for a channel that the multiplexer does not have
+var ErrInvalidChannel = errors.New("invalid multiplexer channel")
+
+// DeviceOpener is a bus that devices can be opened on, such as a Bus, a RemoteBus
+// or a channel of a multiplexer
+type DeviceOpener interface {
+	Open(address uint8) *I2C
+}
+
+// TCA9548A is an I2C multiplexer with 8 downstream channels, each of which is used
+// as a bus of its own so that identical modules with the same fixed address can be
+// used on different channels. The channel is selected before each transaction and
+// the multiplexer is locked for the transaction, so the transactions on different
+// channels are serialised.
+//
+// By default the last channel used stays enabled, and is not selected again for
+// the next transaction on it. Its devices are then also on the parent bus, and a
+// selection made by another process or client of the multiplexer is not seen.
+// SetDeselect disables the channels after each transaction instead.
+type TCA9548A struct {
+	i2c    *I2C
+	parent DeviceOpener
+	bus    *Bus // the bus opened by NewTCA9548A, closed with the multiplexer
+
+	mu       sync.Mutex // held while a channel is selected and used
+	selected int        // the selected channel or -1 if unknown
+	deselect bool       // disable the channels after each transaction
+	lmu      sync.Mutex
+	locks    map[muxLockKey]*sync.Mutex
+}
+
+// muxLockKey identifies the device at an address on a channel
+type muxLockKey struct {
+	channel int
+	address uint16
+	tenBit  bool
+}
+
+// NewTCA9548A opens the bus and the multiplexer at an address on it
+func NewTCA9548A(addr uint8, bus int) (m *TCA9548A, err error) {
+	var b *Bus
+	if b, err = OpenBus(bus); err != nil {
+		return
+	}
+
+	if m, err = NewTCA9548AOnBus(b, addr); err != nil {
+		b.Close()
+		return
+	}
+
+	m.bus = b
+	return
+}
+
+// NewTCA9548AOnBus creates a new TCA9548A instance for the multiplexer at an
+// address on a bus. The channels open their devices on the bus.
+func NewTCA9548AOnBus(parent DeviceOpener, addr uint8) (m *TCA9548A, err error) {
+	m = &TCA9548A{
+		i2c:      parent.Open(addr),
+		parent:   parent,
+		selected: -1,
+		locks:    make(map[muxLockKey]*sync.Mutex),
+	}
+
+	// Deselect all the channels so that the downstream buses start isolated
+	if err = m.selectChannel(-1); err != nil {
+		return
+	}
+
+	return
+}
+
+// Channel returns a downstream channel of the multiplexer from 0 to 7
+func (m *TCA9548A) Channel(n int) (ch *MuxChannel, err error) {
+	if n < 0 || n >= TCA9548AChannels {
+		err = fmt.Errorf("%w: TCA9548A channel %d is not between 0 and %d", ErrInvalidChannel, n, TCA9548AChannels-1)
+		return
+	}
+
+	ch = &MuxChannel{mux: m, channel: n}
+	return
+}
+
+// Selected reads the mask of the channels enabled in the control register
+func (m *TCA9548A) Selected() (mask byte, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	buf := []byte{0}
+	if err = m.i2c.Transfer(Msg{Read: true, Data: buf}); err != nil {
+		return
+	}
+
+	mask = buf[0]
+	return
+}
+
+// Deselect disables all the channels
+func (m *TCA9548A) Deselect() (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.selectChannel(-1)
+}
+
+// SetDeselect sets whether to disable all the channels after each transaction,
+// so that the devices on the channels are isolated from the parent bus between
+// transactions at the cost of a write to the multiplexer for each
+func (m *TCA9548A) SetDeselect(on bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deselect = on
+}
+
+// selectChannel enables only a channel, or none if -1, unless it is already
+// selected. Must be called with the multiplexer lock held.
+func (m *TCA9548A) selectChannel(n int) (err error) {
+	if m.selected == n && n >= 0 {
+		return
+	}
+
+	var mask byte
+	if n >= 0 {
+		mask = 1 << uint(n)
+	}
+
+	if err = m.i2c.Write([]byte{mask}); err != nil {
+		m.selected = -1
+		return
+	}
+
+	m.selected = n
+	return
+}
+
+// use selects a channel and makes a transaction on it with the multiplexer
+// locked, then disables the channels if set to deselect
+func (m *TCA9548A) use(n int, fn func() error) (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err = m.selectChannel(n); err != nil {
+		return
+	}
+
+	err = fn()
+	if m.deselect {
+		if e := m.selectChannel(-1); err == nil {
+			err = e
+		}
+	}
+
+	return
+}
+
+// addressLock returns the lock for multi-step sequences with the device at an address on a channel
+func (m *TCA9548A) addressLock(n int, address uint16, tenBit bool) *sync.Mutex {
+	m.lmu.Lock()
+	defer m.lmu.Unlock()
+
+	key := muxLockKey{channel: n, address: address, tenBit: tenBit}
+	l, ok := m.locks[key]
+	if !ok {
+		l = new(sync.Mutex)
+		m.locks[key] = l
+	}
+
+	return l
+}
+
+// Close closes the handle to the multiplexer, and the bus if it was opened by NewTCA9548A
+func (m *TCA9548A) Close() {
+	m.i2c.Close()
+	if m.bus != nil {
+		m.bus.Close()
+	}
+}
+
+// MuxChannel is a downstream channel of a TCA9548A used as a bus
+type MuxChannel struct {
+	mux     *TCA9548A
+	channel int
+}
+
+// Number returns the channel number
+func (ch *MuxChannel) Number() int {
+	return ch.channel
+}
+
+// Open returns a handle to the device at an address on the channel, which can
+// be passed to any of the NewXxxWithConn driver constructors. Closing the handle
+// does not close the multiplexer.
+func (ch *MuxChannel) Open(address uint8) *I2C {
+	return NewI2C(&muxConn{ch: ch, conn: ch.mux.parent.Open(address).Conn})
+}
+
+// muxConn is a device on a channel of a multiplexer, making each transaction
+// with the connection on the parent bus after selecting the channel. The handle
+// of the device retries and traces the transactions with the defaults of the
+// parent bus.
+type muxConn struct {
+	ch   *MuxChannel
+	conn Conn
+}
+
+func (c *muxConn) use(fn func() error) error {
+	return c.ch.mux.use(c.ch.channel, fn)
+}
+
+func (c *muxConn) Address() uint16 {
+	if a, ok := c.conn.(interface{ Address() uint16 }); ok {
+		return a.Address()
+	}
+
+	return 0
+}
+
+// TenBit reports whether the address of the device is a 10-bit address
+func (c *muxConn) TenBit() bool {
+	if t, ok := c.conn.(interface{ TenBit() bool }); ok {
+		return t.TenBit()
+	}
+
+	return false
+}
+
+// Functionality returns what the adapter of the parent bus supports
+func (c *muxConn) Functionality() Functionality {
+	if d, ok := c.conn.(interface{ Functionality() Functionality }); ok {
+		return d.Functionality()
+	}
+
+	return 0
+}
+
+func (c *muxConn) busNumber() int {
+	if b, ok := c.conn.(interface{ busNumber() int }); ok {
+		return b.busNumber()
+	}
+
+	return -1
+}
+
+// muxChannel returns the channel of the device for its transactions
+func (c *muxConn) muxChannel() int {
+	return c.ch.channel
+}
+
+func (c *muxConn) tracer() Tracer {
+	if d, ok := c.conn.(tracerDefaults); ok {
+		return d.tracer()
+	}
+
+	return nil
+}
+
+func (c *muxConn) retryPolicy() *RetryPolicy {
+	if d, ok := c.conn.(retryDefaults); ok {
+		return d.retryPolicy()
+	}
+
+	return nil
+}
+
+func (c *muxConn) addRetries(n uint64) {
+	if d, ok := c.conn.(retryDefaults); ok {
+		d.addRetries(n)
+	}
+}
+
+func (c *muxConn) ReadReg(reg byte, length int) (val []byte, err error) {
+	err = c.use(func() (err error) {
+		val, err = c.conn.ReadReg(reg, length)
+		return
+	})
+
+	return
+}
+
+func (c *muxConn) ReadReg16(reg uint16, length int) (val []byte, err error) {
+	err = c.use(func() (err error) {
+		val, err = c.conn.ReadReg16(reg, length)
+		return
+	})
+
+	return
+}
+
+func (c *muxConn) ReadRegInto(reg byte, buf []byte) (err error) {
+	return c.use(func() (err error) {
+		if r, ok := c.conn.(IntoReader); ok {
+			return r.ReadRegInto(reg, buf)
+		}
+
+		var val []byte
+		val, err = c.conn.ReadReg(reg, len(buf))
+		copy(buf, val)
+		return
+	})
+}
+
+func (c *muxConn) ReadReg16Into(reg uint16, buf []byte) (err error) {
+	return c.use(func() (err error) {
+		if r, ok := c.conn.(IntoReader); ok {
+			return r.ReadReg16Into(reg, buf)
+		}
+
+		var val []byte
+		val, err = c.conn.ReadReg16(reg, len(buf))
+		copy(buf, val)
+		return
+	})
+}
+
+func (c *muxConn) Write(val []byte) (err error) {
+	return c.use(func() error { return c.conn.Write(val) })
+}
+
+func (c *muxConn) WriteReg(reg byte, val []byte) (err error) {
+	return c.use(func() error { return c.conn.WriteReg(reg, val) })
+}
+
+func (c *muxConn) WriteReg16(reg uint16, val []byte) (err error) {
+	return c.use(func() error { return c.conn.WriteReg16(reg, val) })
+}
+
+func (c *muxConn) Transfer(msgs ...Msg) (err error) {
+	t, ok := c.conn.(Transferer)
+	if !ok {
+		return ErrNotSupported
+	}
+
+	return c.use(func() error { return t.Transfer(msgs...) })
+}
+
+func (c *muxConn) SMBus(read bool, command byte, protocol SMBusProtocol, data []byte) (err error) {
+	s, ok := c.conn.(SMBusConn)
+	if !ok {
+		return ErrNotSupported
+	}
+
+	return c.use(func() error { return s.SMBus(read, command, protocol, data) })
+}
+
+func (c *muxConn) SetPEC(on bool) (err error) {
+	s, ok := c.conn.(SMBusConn)
+	if !ok {
+		return ErrNotSupported
+	}
+
+	return s.SetPEC(on)
+}
+
+// Lock acquires the device on the channel, which is not shared with devices at
+// the same address on other channels
+func (c *muxConn) Lock() {
+	c.ch.mux.addressLock(c.ch.channel, c.Address(), c.TenBit()).Lock()
+}
+
+func (c *muxConn) TryLock() bool {
+	return c.ch.mux.addressLock(c.ch.channel, c.Address(), c.TenBit()).TryLock()
+}
+
+func (c *muxConn) Unlock() {
+	c.ch.mux.addressLock(c.ch.channel, c.Address(), c.TenBit()).Unlock()
+}
+
+func (c *muxConn) Close() {
+	c.conn.Close()
+}
@@ -0,0 +1,155 @@
+package piicodev
+
+import (
+	"bytes"
+	"errors"
+	"math/bits"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// fakeMuxBus is a bus with a multiplexer and a device at the same address on each
+// channel, with a default tracer and retry policy for the devices opened on it
+type fakeMuxBus struct {
+	mux     *FakeConn
+	devices [TCA9548AChannels]*FakeConn
+	tracer  Tracer
+	retry   *RetryPolicy
+	retries uint64
+}
+
+func (b *fakeMuxBus) Open(address uint8) *I2C {
+	if address == TCA9548AAddress {
+		return NewI2C(b.mux)
+	}
+
+	return NewI2C(&fakeChannelConn{b: b})
+}
+
+// fakeChannelConn reads from the device on the channel last selected with the multiplexer
+type fakeChannelConn struct {
+	Conn
+	b *fakeMuxBus
+}
+
+func (c *fakeChannelConn) ReadReg(reg byte, length int) (val []byte, err error) {
+	writes := c.b.mux.Writes()
+	mask := writes[len(writes)-1][0]
+	if bits.OnesCount8(mask) != 1 {
+		return nil, &I2CError{Op: "read", Bus: -1, Reg: int(reg), Errno: syscall.ENXIO}
+	}
+
+	return c.b.devices[bits.TrailingZeros8(mask)].ReadReg(reg, length)
+}
+
+func (c *fakeChannelConn) busNumber() int {
+	return 1
+}
+
+func (c *fakeChannelConn) tracer() Tracer {
+	return c.b.tracer
+}
+
+func (c *fakeChannelConn) retryPolicy() *RetryPolicy {
+	return c.b.retry
+}
+
+func (c *fakeChannelConn) addRetries(n uint64) {
+	c.b.retries += n
+}
+
+func (c *fakeChannelConn) Close() {
+}
+
+func TestTCA9548A(t *testing.T) {
+	b := &fakeMuxBus{mux: NewFakeConn()}
+	for i := range b.devices {
+		b.devices[i] = NewFakeConn()
+		b.devices[i].SetReg(_LM75A_REG_TEMPERATURE, byte(20+i), 0x00)
+	}
+
+	m, err := NewTCA9548AOnBus(b, TCA9548AAddress)
+	if err != nil {
+		t.Fatalf("Error creating the TCA9548A: %v", err)
+	}
+
+	if _, err = m.Channel(TCA9548AChannels); !errors.Is(err, ErrInvalidChannel) {
+		t.Errorf("Channel %d did not fail", TCA9548AChannels)
+	}
+
+	sensors := make([]*LM75A, 2)
+	for i := range sensors {
+		ch, _ := m.Channel(i + 3)
+		sensors[i], _ = NewLM75AWithConn(ch.Open(LM75AAddress))
+	}
+
+	var wg sync.WaitGroup
+	for i, s := range sensors {
+		wg.Add(1)
+		go func(i int, s *LM75A) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if temp, err := s.ReadTemperature(); err != nil || temp != float64(23+i) {
+					t.Errorf("Temperature on channel %d is %f (%v)", i+3, temp, err)
+					return
+				}
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	if err = m.Deselect(); err != nil {
+		t.Errorf("Error deselecting the channels: %v", err)
+	}
+
+	b.mux.ClearLog()
+	for _, s := range []*LM75A{sensors[0], sensors[0], sensors[1]} {
+		if _, err = s.ReadTemperature(); err != nil {
+			t.Errorf("Error reading the temperature: %v", err)
+		}
+	}
+
+	if writes := b.mux.Writes(); len(writes) != 2 || !bytes.Equal(writes[0], []byte{1 << 3}) || !bytes.Equal(writes[1], []byte{1 << 4}) {
+		t.Errorf("Multiplexer selections were %X rather than channels 3 and 4", writes)
+	}
+
+	if m.addressLock(0, 0x129, true) == m.addressLock(1, 0x29, false) {
+		t.Errorf("10-bit address 0x129 on channel 0 shares the lock of 0x29 on channel 1")
+	}
+}
+
+func TestTCA9548ADeselectAndTrace(t *testing.T) {
+	b := &fakeMuxBus{mux: NewFakeConn(), retry: &RetryPolicy{MaxAttempts: 2}}
+	for i := range b.devices {
+		b.devices[i] = NewFakeConn()
+		b.devices[i].SetReg(_LM75A_REG_TEMPERATURE, byte(20+i), 0x00)
+	}
+
+	var txs []Transaction
+	b.tracer = TracerFunc(func(tx *Transaction) { txs = append(txs, *tx) })
+
+	m, _ := NewTCA9548AOnBus(b, TCA9548AAddress)
+	m.SetDeselect(true)
+
+	ch, _ := m.Channel(3)
+	s, _ := NewLM75AWithConn(ch.Open(LM75AAddress))
+
+	b.mux.ClearLog()
+	b.devices[3].QueueError(&I2CError{Op: "read", Bus: 1, Reg: _LM75A_REG_TEMPERATURE, Errno: syscall.EREMOTEIO})
+	if temp, err := s.ReadTemperature(); err != nil || temp != 23 {
+		t.Errorf("Temperature on channel 3 is %f (%v)", temp, err)
+	}
+
+	if writes := b.mux.Writes(); len(writes) != 4 || !bytes.Equal(writes[2], []byte{1 << 3}) || !bytes.Equal(writes[3], []byte{0}) {
+		t.Errorf("Multiplexer writes were %X rather than selecting and deselecting channel 3 twice", writes)
+	}
+
+	if len(txs) != 2 || txs[0].Bus != 1 || txs[0].Channel != 3 || txs[0].Errno != syscall.EREMOTEIO || !txs[1].Retry {
+		t.Errorf("Traced transactions on channel 3 are %+v", txs)
+	}
+
+	if b.retries != 1 {
+		t.Errorf("Counted %d retries on the parent bus rather than 1", b.retries)
+	}
+}
@@ -3,13 +3,27 @@ package piicodev
 
 const TMP117Address = 0x48
 
+const (
+	_TMP117_REG_DEVICE_ID = 0x0F
+	_TMP117_DEVICE_ID     = 0x0117 // bits 11:0 of the device ID register
+)
+
 type TMP117 struct {
 	i2c *I2C
 }
 
 func NewTMP117(addr uint8, bus int) (t *TMP117, err error) {
-	t = &TMP117{}
-	t.i2c, err = OpenI2C(addr, bus)
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
+		return
+	}
+
+	return NewTMP117WithConn(i2c)
+}
+
+// NewTMP117WithConn creates a new TMP117 instance on an already open connection
+func NewTMP117WithConn(conn Conn) (t *TMP117, err error) {
+	t = &TMP117{i2c: NewI2C(conn)}
 	return
 }
 
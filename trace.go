@@ -0,0 +1,213 @@
+// Tracing the I2C transactions made with devices
+package piicodev
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"syscall"
+	"time"
+)
+
+// The operations of a Transaction
+const (
+	OpRead       = "read"        // a register read
+	OpWrite      = "write"       // a raw or register write
+	OpTransfer   = "transfer"    // a combined transaction of read and write messages
+	OpSMBusRead  = "smbus read"  // an SMBus read
+	OpSMBusWrite = "smbus write" // an SMBus write or process call
+	OpProbe      = "probe"       // a probe of an address by a scan
+)
+
+// Transaction is a single I2C transaction reported to a Tracer
+type Transaction struct {
+	Bus      int           // the bus number, or -1 if the connection is not on a Bus
+	Channel  int           // the multiplexer channel of the device, or -1 if it is not behind a multiplexer
+	Address  uint16        // the device address
+	TenBit   bool          // the address is a 10-bit address
+	Op       string        // the operation, one of the Op constants
+	Reg      int           // the register address or -1 if the operation was not on a register
+	Data     []byte        // the bytes written for a write or the bytes read for a read
+	Duration time.Duration // the time taken by the transaction
+	Retry    bool          // the transaction is a retry of a failed transaction
+	Errno    syscall.Errno // the errno of a failed transaction or 0
+	Err      error         // the error of a failed transaction or nil
+}
+
+// Tracer receives every transaction made with a device. Trace is called from the
+// goroutine making the transaction and must not retain or modify tx.Data.
+type Tracer interface {
+	Trace(tx *Transaction)
+}
+
+// TracerFunc is a function used as a Tracer
+type TracerFunc func(tx *Transaction)
+
+// Trace calls the function with the transaction
+func (f TracerFunc) Trace(tx *Transaction) {
+	f(tx)
+}
+
+// MultiTracer returns a tracer that reports every transaction to each of the
+// tracers in turn, such as a SlogTracer and Metrics
+func MultiTracer(tracers ...Tracer) Tracer {
+	return TracerFunc(func(tx *Transaction) {
+		for _, t := range tracers {
+			t.Trace(tx)
+		}
+	})
+}
+
+// tracerDefaults is implemented by connections with a default tracer, such as the devices on a Bus
+type tracerDefaults interface {
+	tracer() Tracer
+}
+
+// SetTracer sets the tracer for the device, overriding the tracer of the Bus it
+// was opened on. Nil uses the tracer of the Bus, if any, or disables tracing.
+func (i2c *I2C) SetTracer(t Tracer) {
+	i2c = i2c.device()
+	i2c.cfgMu.Lock()
+	defer i2c.cfgMu.Unlock()
+
+	i2c.tracer = t
+}
+
+// Tracer returns the tracer used for the device or nil if it is not traced
+func (i2c *I2C) Tracer() (t Tracer) {
+	i2c = i2c.device()
+	i2c.cfgMu.Lock()
+	t = i2c.tracer
+	i2c.cfgMu.Unlock()
+
+	if t == nil {
+		if d, ok := i2c.Conn.(tracerDefaults); ok {
+			t = d.tracer()
+		}
+	}
+
+	return
+}
+
+// trace reports a transaction with the device to a tracer
+func (i2c *I2C) trace(t Tracer, op string, reg int, data []byte, duration time.Duration, retry bool, err error) {
+	tx := Transaction{
+		Bus:      -1,
+		Channel:  -1,
+		Address:  i2c.Address(),
+		TenBit:   i2c.TenBit(),
+		Op:       op,
+		Reg:      reg,
+		Data:     data,
+		Duration: duration,
+		Retry:    retry,
+		Err:      err,
+	}
+
+	if d, ok := i2c.Conn.(interface{ busNumber() int }); ok {
+		tx.Bus = d.busNumber()
+	}
+
+	if d, ok := i2c.Conn.(interface{ muxChannel() int }); ok {
+		tx.Channel = d.muxChannel()
+	}
+
+	errors.As(err, &tx.Errno)
+	t.Trace(&tx)
+}
+
+// SetTracer sets the default tracer for all the devices opened on the bus and the probes of a scan
+func (b *Bus) SetTracer(t Tracer) {
+	b.cfgMu.Lock()
+	defer b.cfgMu.Unlock()
+
+	b.tracer = t
+}
+
+// Tracer returns the default tracer of the bus or nil if it is not traced
+func (b *Bus) Tracer() Tracer {
+	b.cfgMu.Lock()
+	defer b.cfgMu.Unlock()
+
+	return b.tracer
+}
+
+func (d *devConn) busNumber() int {
+	return d.bus.bus
+}
+
+func (d *devConn) tracer() Tracer {
+	return d.bus.Tracer()
+}
+
+// SlogTracer is a Tracer that logs each transaction with log/slog. Successful
+// transactions are logged at Level and failed transactions at slog.LevelWarn.
+type SlogTracer struct {
+	Logger *slog.Logger
+	Level  slog.Level
+}
+
+// NewSlogTracer creates a tracer logging to a logger, or to slog.Default() if nil, at slog.LevelDebug
+func NewSlogTracer(logger *slog.Logger) *SlogTracer {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &SlogTracer{Logger: logger, Level: slog.LevelDebug}
+}
+
+// Trace logs a transaction
+func (t *SlogTracer) Trace(tx *Transaction) {
+	level := t.Level
+	if tx.Err != nil {
+		level = slog.LevelWarn
+	}
+
+	ctx := context.Background()
+	if !t.Logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.Int("bus", tx.Bus),
+	}
+
+	if tx.Channel >= 0 {
+		attrs = append(attrs, slog.Int("channel", tx.Channel))
+	}
+
+	attrs = append(attrs,
+		slog.String("address", formatTraceAddress(tx.Address, tx.TenBit)),
+		slog.String("op", tx.Op),
+	)
+
+	if tx.Reg >= 0 {
+		attrs = append(attrs, slog.String("reg", fmt.Sprintf("0x%X", tx.Reg)))
+	}
+
+	attrs = append(attrs,
+		slog.String("data", hex.EncodeToString(tx.Data)),
+		slog.Duration("duration", tx.Duration),
+	)
+
+	if tx.Retry {
+		attrs = append(attrs, slog.Bool("retry", true))
+	}
+
+	if tx.Err != nil {
+		attrs = append(attrs, slog.Int("errno", int(tx.Errno)), slog.String("err", tx.Err.Error()))
+	}
+
+	t.Logger.LogAttrs(ctx, level, "i2c transaction", attrs...)
+}
+
+// formatTraceAddress formats the address of a transaction
+func formatTraceAddress(address uint16, tenBit bool) string {
+	if tenBit {
+		return fmt.Sprintf("0x%03X (10-bit)", address)
+	}
+
+	return fmt.Sprintf("0x%02X", address)
+}
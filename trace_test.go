@@ -0,0 +1,94 @@
+package piicodev
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTracer(t *testing.T) {
+	f := NewFakeConn()
+	f.SetReg(0x20, 0x12, 0x34)
+
+	var txs []Transaction
+	i2c := NewI2C(f)
+	i2c.SetTracer(TracerFunc(func(tx *Transaction) {
+		tx.Data = append([]byte{}, tx.Data...)
+		txs = append(txs, *tx)
+	}))
+	i2c.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2})
+
+	f.QueueError(&I2CError{Op: "read", Reg: 0x20, Errno: syscall.EREMOTEIO})
+	if _, err := i2c.ReadRegU16BE(0x20); err != nil {
+		t.Fatalf("Error reading register: %v", err)
+	}
+
+	if err := i2c.WriteReg16U8(0x2D, 0x01); err != nil {
+		t.Fatalf("Error writing register: %v", err)
+	}
+
+	if len(txs) != 3 {
+		t.Fatalf("Traced %d transactions rather than 3", len(txs))
+	}
+
+	if tx := txs[0]; tx.Op != "read" || tx.Reg != 0x20 || tx.Errno != syscall.EREMOTEIO || tx.Bus != -1 {
+		t.Errorf("Unexpected trace of the failed read: %+v", tx)
+	}
+
+	if tx := txs[1]; tx.Op != "read" || tx.Errno != 0 || !bytes.Equal(tx.Data, []byte{0x12, 0x34}) {
+		t.Errorf("Unexpected trace of the retried read: %+v", tx)
+	}
+
+	if tx := txs[2]; tx.Op != "write" || tx.Reg != 0x2D || !bytes.Equal(tx.Data, []byte{0x01}) {
+		t.Errorf("Unexpected trace of the write: %+v", tx)
+	}
+}
+
+func TestSlogTracer(t *testing.T) {
+	var out bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	i2c := NewI2C(NewFakeConn())
+	i2c.SetTracer(NewSlogTracer(logger))
+
+	if err := i2c.WriteReg(0x2D, []byte{0xAB, 0xCD}); err != nil {
+		t.Fatalf("Error writing register: %v", err)
+	}
+
+	for _, s := range []string{"level=DEBUG", "op=write", "reg=0x2D", "data=abcd"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Log %q does not contain %q", out.String(), s)
+		}
+	}
+}
+
+// slowConn is a connection whose reads take time on a fake clock
+type slowConn struct {
+	Conn
+	clock *FakeClock
+}
+
+func (c *slowConn) ReadReg(reg byte, length int) ([]byte, error) {
+	c.clock.Advance(3 * time.Millisecond)
+	return c.Conn.ReadReg(reg, length)
+}
+
+func TestTracerClock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+
+	var tx Transaction
+	i2c := NewI2C(&slowConn{Conn: NewFakeConn(), clock: clock})
+	i2c.SetClock(clock)
+	i2c.SetTracer(TracerFunc(func(t *Transaction) { tx = *t }))
+
+	if _, err := i2c.ReadReg(0x10, 1); err != nil {
+		t.Fatalf("Error reading register: %v", err)
+	}
+
+	if tx.Op != OpRead || tx.Duration != 3*time.Millisecond {
+		t.Errorf("Read traced as %s taking %v rather than 3ms on the clock", tx.Op, tx.Duration)
+	}
+}
@@ -67,11 +67,18 @@ type VEML6030 struct {
 }
 
 func NewVEML6030(addr uint8, bus int) (l *VEML6030, err error) {
-	l = &VEML6030{}
-	if l.i2c, err = OpenI2C(addr, bus); err != nil {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
 		return
 	}
 
+	return NewVEML6030WithConn(i2c)
+}
+
+// NewVEML6030WithConn creates a new VEML6030 instance on an already open connection
+func NewVEML6030WithConn(conn Conn) (l *VEML6030, err error) {
+	l = &VEML6030{i2c: NewI2C(conn)}
+
 	err = l.PowerOn()
 	return
 }
@@ -225,6 +232,9 @@ func (l *VEML6030) Read() (light float64, err error) {
 
 // updateRegister updates the appropriate bits in a register
 func (l *VEML6030) updateRegister(reg byte, mask uint16, bits uint16, startPos uint8) (err error) {
+	l.i2c.Lock()
+	defer l.i2c.Unlock()
+
 	var v uint16
 	if v, err = l.i2c.ReadRegU16LE(reg); err != nil {
 		return
@@ -3,6 +3,7 @@
 package piicodev
 
 import (
+	"context"
 	"math"
 	"time"
 )
@@ -18,6 +19,11 @@ const (
 
 	VEML6040DefaultSettings = 0x00 // initialise gain:1x, integration 40ms, Green Sensitivity 0.25168, Max. Detectable Lux 16496, No Trig, Auto mode, enabled.
 	VEML6040Shutdown        = 0x01
+
+	_VEML6040_GREEN_SENSITIVITY = 0.25168 // lux per count of the green channel with the 40ms integration time
+	_VEML6040_IT_MASK           = 0x70    // the integration time in the configuration, 40ms doubling with each step
+	_VEML6040_IT_SHIFT          = 4
+	_VEML6040_IT_MAX            = 5 // 1280ms, the longest integration time
 )
 
 type VEML6040 struct {
@@ -26,11 +32,26 @@ type VEML6040 struct {
 
 // NewVEML6040 creates a new VEML6040 instances
 func NewVEML6040(addr uint8, bus int) (c *VEML6040, err error) {
-	c = &VEML6040{}
-	if c.i2c, err = OpenI2C(addr, bus); err != nil {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
 		return
 	}
 
+	return NewVEML6040WithConn(i2c)
+}
+
+// NewVEML6040WithConn creates a new VEML6040 instance on an already open connection
+func NewVEML6040WithConn(conn Conn) (c *VEML6040, err error) {
+	return NewVEML6040WithConnContext(context.Background(), conn)
+}
+
+// NewVEML6040WithConnContext creates a new VEML6040 instance on an already open
+// connection, stopping the wait for the initialisation if the context is done
+func NewVEML6040WithConnContext(ctx context.Context, conn Conn) (c *VEML6040, err error) {
+	i2c := NewI2C(conn)
+	c = &VEML6040{i2c: i2c.withContext(ctx)}
+	defer func() { c.i2c = i2c }()
+
 	if err = c.i2c.WriteRegU8(VEML6040ConfigReg, VEML6040Shutdown); err != nil {
 		return
 	}
@@ -40,7 +61,7 @@ func NewVEML6040(addr uint8, bus int) (c *VEML6040, err error) {
 	}
 
 	// Need to wait for initialization
-	time.Sleep(50 * time.Millisecond)
+	err = c.i2c.sleep(ctx, 50*time.Millisecond)
 	return
 }
 
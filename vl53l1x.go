@@ -2,12 +2,20 @@
 package piicodev
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
 
 const (
 	VL53L1XAddress = 0x29
+
+	_VL53L1X_I2C_SLAVE__DEVICE_ADDRESS = 0x0001
+	_VL53L1X_MODEL_ID_REG              = 0x010F
+	_VL53L1X_MODEL_ID                  = 0xEACC
+
+	// the time for the sensor to boot after its XSHUT pin is released
+	_VL53L1X_BOOT_TIME = 2 * time.Millisecond
 )
 
 var (
@@ -108,15 +116,31 @@ var (
 
 type VL53L1X struct {
 	i2c *I2C
+	buf [17]byte
 }
 
 func NewVL53L1X(addr uint8, bus int) (d *VL53L1X, err error) {
-	d = &VL53L1X{}
-	if d.i2c, err = OpenI2C(addr, bus); err != nil {
+	var i2c *I2C
+	if i2c, err = OpenI2C(addr, bus); err != nil {
 		return
 	}
 
-	if err = d.Reset(); err != nil {
+	return NewVL53L1XWithConn(i2c)
+}
+
+// NewVL53L1XWithConn creates a new VL53L1X instance on an already open connection
+func NewVL53L1XWithConn(conn Conn) (d *VL53L1X, err error) {
+	return NewVL53L1XWithConnContext(context.Background(), conn)
+}
+
+// NewVL53L1XWithConnContext creates a new VL53L1X instance on an already open
+// connection, stopping the waits for the reset and configuration if the context is done
+func NewVL53L1XWithConnContext(ctx context.Context, conn Conn) (d *VL53L1X, err error) {
+	i2c := NewI2C(conn)
+	d = &VL53L1X{i2c: i2c.withContext(ctx)}
+	defer func() { d.i2c = i2c }()
+
+	if err = d.ResetContext(ctx); err != nil {
 		return
 	}
 
@@ -125,8 +149,8 @@ func NewVL53L1X(addr uint8, bus int) (d *VL53L1X, err error) {
 		return
 	}
 
-	if modelID != 0xEACC {
-		err = fmt.Errorf("model ID of VL53L1X device is 0x%X and not 0xEACC", modelID)
+	if modelID != _VL53L1X_MODEL_ID {
+		err = &DeviceIDError{Device: "VL53L1X", ID: modelID, Expected: []uint16{_VL53L1X_MODEL_ID}}
 		return
 	}
 
@@ -135,7 +159,9 @@ func NewVL53L1X(addr uint8, bus int) (d *VL53L1X, err error) {
 		return
 	}
 
-	time.Sleep(100 * time.Millisecond)
+	if err = d.i2c.sleep(ctx, 100*time.Millisecond); err != nil {
+		return
+	}
 
 	// the API triggers this change in VL53L1_init_and_start_range() once a
 	// measurement is started; assumes MM1 and MM2 are disabled
@@ -148,33 +174,45 @@ func NewVL53L1X(addr uint8, bus int) (d *VL53L1X, err error) {
 		return
 	}
 
-	time.Sleep(200 * time.Millisecond)
-
+	err = d.i2c.sleep(ctx, 200*time.Millisecond)
 	return
 }
 
 func (d *VL53L1X) Reset() (err error) {
+	return d.ResetContext(context.Background())
+}
+
+// ResetContext makes a software reset, stopping the waits for the reset if the context is done
+func (d *VL53L1X) ResetContext(ctx context.Context) (err error) {
+	i2c := d.i2c.withContext(ctx)
+
 	var i byte
 	for i = 0; i <= 1; i++ {
-		if err = d.i2c.WriteReg16U8(0x0000, i); err != nil {
+		if err = i2c.WriteReg16U8(0x0000, i); err != nil {
+			return
+		}
+
+		if err = i2c.sleep(ctx, 100*time.Millisecond); err != nil {
 			return
 		}
-		time.Sleep(100 * time.Millisecond)
 	}
 
 	return
 }
 
 func (d *VL53L1X) ReadModelID() (modelID uint16, err error) {
-	if modelID, err = d.i2c.ReadReg16U16BE(0x010F); err != nil {
+	if modelID, err = d.i2c.ReadReg16U16BE(_VL53L1X_MODEL_ID_REG); err != nil {
 		return
 	}
 	return
 }
 
 func (d *VL53L1X) Read() (rng uint16, err error) {
-	var data []byte
-	if data, err = d.i2c.ReadReg16(0x0089, 17); err != nil {
+	d.i2c.Lock()
+	defer d.i2c.Unlock()
+
+	data := d.buf[:]
+	if err = d.i2c.ReadReg16Into(0x0089, data); err != nil {
 		return
 	}
 
@@ -220,6 +258,86 @@ func (d *VL53L1X) Read() (rng uint16, err error) {
 	return
 }
 
+// SetAddress changes the I2C address of the sensor to an address from 0x08 to 0x77,
+// moves the handle to the new address and checks that the sensor answers there.
+// The sensor returns to VL53L1XAddress when it is powered off or shut down with
+// its XSHUT pin.
+func (d *VL53L1X) SetAddress(address uint8) (err error) {
+	d.i2c, err = changeAddress(d.i2c, "VL53L1X", address,
+		func() error { return d.i2c.WriteReg16U8(_VL53L1X_I2C_SLAVE__DEVICE_ADDRESS, address) },
+		func(i2c *I2C) bool {
+			id, err := i2c.ReadReg16U16BE(_VL53L1X_MODEL_ID_REG)
+			return err == nil && id == _VL53L1X_MODEL_ID
+		})
+
+	return
+}
+
+// NewVL53L1XArray brings up several sensors on a bus which all boot at
+// VL53L1XAddress. The sensors must start with their XSHUT pins held low. For each
+// address in turn enable is called to release the XSHUT pin of the sensor with
+// that index, then the sensor is created and moved to the address. The addresses
+// are checked before any sensor is enabled: they must be unique, from
+// ScanFirstAddress to ScanLastAddress, and only the last may be VL53L1XAddress,
+// leaving that sensor where it booted. On failure the sensors brought up so far
+// are returned with the error and the handle of the sensor that failed is
+// closed. That sensor is left enabled, at VL53L1XAddress or its new address, so
+// hold its XSHUT pin low again before retrying.
+func NewVL53L1XArray(bus DeviceOpener, addresses []uint8, enable func(i int) error) (sensors []*VL53L1X, err error) {
+	return NewVL53L1XArrayContext(context.Background(), bus, addresses, enable)
+}
+
+// NewVL53L1XArrayContext brings up several sensors on a bus like NewVL53L1XArray,
+// stopping the waits for the sensors if the context is done
+func NewVL53L1XArrayContext(ctx context.Context, bus DeviceOpener, addresses []uint8, enable func(i int) error) (sensors []*VL53L1X, err error) {
+	seen := make(map[uint8]bool)
+	for i, address := range addresses {
+		if address < ScanFirstAddress || address > ScanLastAddress {
+			err = fmt.Errorf("%w 0x%X for VL53L1X %d, must be from 0x%X to 0x%X", ErrInvalidAddress, address, i, ScanFirstAddress, ScanLastAddress)
+			return
+		}
+
+		if seen[address] || (address == VL53L1XAddress && i != len(addresses)-1) {
+			err = fmt.Errorf("%w 0x%X for VL53L1X %d, the addresses must be unique and only the last may be 0x%X", ErrInvalidAddress, address, i, VL53L1XAddress)
+			return
+		}
+
+		seen[address] = true
+	}
+
+	for i, address := range addresses {
+		if err = enable(i); err != nil {
+			err = fmt.Errorf("enabling VL53L1X %d: %w", i, err)
+			return
+		}
+
+		i2c := bus.Open(VL53L1XAddress)
+		if err = i2c.sleep(ctx, _VL53L1X_BOOT_TIME); err != nil {
+			i2c.Close()
+			return
+		}
+
+		var d *VL53L1X
+		if d, err = NewVL53L1XWithConnContext(ctx, i2c); err != nil {
+			i2c.Close()
+			err = fmt.Errorf("VL53L1X %d: %w", i, err)
+			return
+		}
+
+		if address != VL53L1XAddress {
+			if err = d.SetAddress(address); err != nil {
+				d.Close()
+				err = fmt.Errorf("VL53L1X %d: %w", i, err)
+				return
+			}
+		}
+
+		sensors = append(sensors, d)
+	}
+
+	return
+}
+
 func (d *VL53L1X) Close() {
 	d.i2c.Close()
 }
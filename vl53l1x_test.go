@@ -0,0 +1,158 @@
+package piicodev
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeVL53L1XBus is a bus of VL53L1X sensors that each answer at the address set
+// in their I2C_SLAVE__DEVICE_ADDRESS register once enabled
+type fakeVL53L1XBus struct {
+	clock     Clock
+	sensors   []*FakeConn
+	addresses []uint8 // the address of each sensor or 0 if shut down
+	closed    int     // the number of handles closed
+}
+
+func newFakeVL53L1XBus(n int) *fakeVL53L1XBus {
+	clock := NewFakeClock(time.Now())
+	clock.SetAutoAdvance(true)
+
+	b := &fakeVL53L1XBus{clock: clock, addresses: make([]uint8, n)}
+	for i := 0; i < n; i++ {
+		f := NewFakeConn()
+		f.SetReg16(_VL53L1X_MODEL_ID_REG, 0xEA, 0xCC)
+		b.sensors = append(b.sensors, f)
+	}
+
+	return b
+}
+
+func (b *fakeVL53L1XBus) Open(address uint8) *I2C {
+	i2c := NewI2C(&fakeVL53L1XConn{b: b, address: address})
+	i2c.SetClock(b.clock)
+	return i2c
+}
+
+// fakeVL53L1XConn is an address on a fakeVL53L1XBus
+type fakeVL53L1XConn struct {
+	Conn
+	b       *fakeVL53L1XBus
+	address uint8
+}
+
+// sensor returns the only sensor answering at the address
+func (c *fakeVL53L1XConn) sensor() (i int, err error) {
+	i = -1
+	for j, a := range c.b.addresses {
+		if a == c.address {
+			if i >= 0 {
+				return -1, &I2CError{Op: "transfer", Bus: -1, Address: uint16(c.address), Reg: -1, Errno: syscall.EIO}
+			}
+
+			i = j
+		}
+	}
+
+	if i < 0 {
+		err = &I2CError{Op: "transfer", Bus: -1, Address: uint16(c.address), Reg: -1, Errno: syscall.ENXIO}
+	}
+
+	return
+}
+
+func (c *fakeVL53L1XConn) ReadReg16(reg uint16, length int) (val []byte, err error) {
+	var i int
+	if i, err = c.sensor(); err != nil {
+		return
+	}
+
+	return c.b.sensors[i].ReadReg16(reg, length)
+}
+
+func (c *fakeVL53L1XConn) WriteReg16(reg uint16, val []byte) (err error) {
+	var i int
+	if i, err = c.sensor(); err != nil {
+		return
+	}
+
+	if err = c.b.sensors[i].WriteReg16(reg, val); err == nil && reg == _VL53L1X_I2C_SLAVE__DEVICE_ADDRESS {
+		c.b.addresses[i] = val[0]
+	}
+
+	return
+}
+
+func (c *fakeVL53L1XConn) withAddress(address uint8) Conn {
+	return &fakeVL53L1XConn{b: c.b, address: address}
+}
+
+func (c *fakeVL53L1XConn) Address() uint16 {
+	return uint16(c.address)
+}
+
+func (c *fakeVL53L1XConn) Close() {
+	c.b.closed++
+}
+
+func TestVL53L1XArray(t *testing.T) {
+	b := newFakeVL53L1XBus(3)
+	enable := func(i int) error {
+		b.addresses[i] = VL53L1XAddress
+		return nil
+	}
+
+	sensors, err := NewVL53L1XArray(b, []uint8{0x30, 0x31, VL53L1XAddress}, enable)
+	if err != nil {
+		t.Fatalf("Error bringing up the sensors: %v", err)
+	}
+
+	for i, expected := range []uint8{0x30, 0x31, VL53L1XAddress} {
+		if b.addresses[i] != expected || sensors[i].i2c.Address() != uint16(expected) {
+			t.Errorf("Sensor %d is at address 0x%X with a handle at 0x%X rather than 0x%X", i, b.addresses[i], sensors[i].i2c.Address(), expected)
+		}
+	}
+
+	b.sensors[1].SetReg16(0x0089+13, 0x01, 0x2C)
+	if rng, err := sensors[1].Read(); err != nil || rng != 300 {
+		t.Errorf("Range of sensor 1 is %d (%v) rather than 300", rng, err)
+	}
+
+	if _, err = NewVL53L1XArray(newFakeVL53L1XBus(2), []uint8{VL53L1XAddress, 0x30}, enable); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("Sensor left at 0x%X before another returned %v", VL53L1XAddress, err)
+	}
+
+	enabled := false
+	if _, err = NewVL53L1XArray(newFakeVL53L1XBus(2), []uint8{0x30, 0x78}, func(i int) error {
+		enabled = true
+		return nil
+	}); !errors.Is(err, ErrInvalidAddress) || enabled {
+		t.Errorf("Sensor address 0x78 returned %v after enabling a sensor: %t", err, enabled)
+	}
+
+	b = newFakeVL53L1XBus(2)
+	failure := errors.New("no GPIO")
+	sensors, err = NewVL53L1XArray(b, []uint8{0x30, 0x31}, func(i int) error {
+		if i == 1 {
+			return failure
+		}
+
+		b.addresses[i] = VL53L1XAddress
+		return nil
+	})
+
+	if !errors.Is(err, failure) || len(sensors) != 1 {
+		t.Errorf("Failure to enable sensor 1 returned %v with %d sensors", err, len(sensors))
+	}
+
+	b = newFakeVL53L1XBus(2)
+	b.sensors[1].SetReg16(_VL53L1X_MODEL_ID_REG, 0x00, 0x00)
+	sensors, err = NewVL53L1XArray(b, []uint8{0x30, 0x31}, enable)
+
+	var idErr *DeviceIDError
+	if !errors.As(err, &idErr) || len(sensors) != 1 || b.closed != 1 {
+		t.Errorf("Sensor 1 with the wrong model ID returned %v with %d sensors and %d closed handles", err, len(sensors), b.closed)
+	}
+}